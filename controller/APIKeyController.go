@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	APIKeyService *services.APIKeyService
+}
+
+func NewAPIKeyController(apiKeyService *services.APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService,
+	}
+}
+
+func (ac *APIKeyController) CreateAPIKey(c *gin.Context) {
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	adminId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	apiKey, key, err := ac.APIKeyService.CreateAPIKey(&req, adminId, heldPermissions(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "don't hold"), strings.Contains(err.Error(), "not held"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "must"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Store the key now, it can't be shown again",
+		"apiKey":  apiKey,
+		"key":     key,
+	})
+}
+
+func (ac *APIKeyController) GetAPIKeys(c *gin.Context) {
+	keys, err := ac.APIKeyService.GetAPIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+func (ac *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	keyId := c.Query("keyId")
+	if keyId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keyId is required"})
+		return
+	}
+
+	err := ac.APIKeyService.RevokeAPIKey(keyId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditoriumController struct {
+	AuditoriumService *services.AuditoriumService
+}
+
+func NewAuditoriumController(auditoriumService *services.AuditoriumService) *AuditoriumController {
+	return &AuditoriumController{
+		auditoriumService,
+	}
+}
+
+func (ac *AuditoriumController) AddAuditorium(c *gin.Context) {
+	var layout models.AuditoriumLayout
+	if err := c.ShouldBindJSON(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	auditorium, err := ac.AuditoriumService.AddAuditorium(&layout)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "failed to") {
+			status = http.StatusInternalServerError
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"auditorium": auditorium})
+}
+
+func (ac *AuditoriumController) GetAuditoriums(c *gin.Context) {
+	auditoriums, err := ac.AuditoriumService.GetAuditoriums()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"auditoriums": auditoriums})
+}
+
+func (ac *AuditoriumController) GetAuditoriumById(c *gin.Context) {
+	auditoriumId := c.Query("auditoriumId")
+	if auditoriumId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "auditoriumId is required"})
+		return
+	}
+
+	auditorium, err := ac.AuditoriumService.GetAuditoriumById(auditoriumId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"auditorium": auditorium})
+}
+
+func (ac *AuditoriumController) DeleteAuditorium(c *gin.Context) {
+	auditoriumId := c.Query("auditoriumId")
+	if auditoriumId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "auditoriumId is required"})
+		return
+	}
+
+	err := ac.AuditoriumService.DeleteAuditorium(auditoriumId)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "still used"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "delete auditorium"):
+			status = http.StatusInternalServerError
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Auditorium deleted successfully"})
+}
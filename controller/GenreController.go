@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenreController struct {
+	GenreService *services.GenreService
+}
+
+func NewGenreController(genreService *services.GenreService) *GenreController {
+	return &GenreController{
+		genreService,
+	}
+}
+
+// genreErrorStatus maps genre service errors to HTTP statuses.
+func genreErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already exists"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "must") || strings.Contains(err.Error(), "itself"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (gc *GenreController) AddGenre(c *gin.Context) {
+	var req models.Genre
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	genre, err := gc.GenreService.AddGenre(req.Name)
+	if err != nil {
+		c.JSON(genreErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"genre": genre})
+}
+
+func (gc *GenreController) GetGenres(c *gin.Context) {
+	genres, err := gc.GenreService.GetGenres()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genres": genres})
+}
+
+func (gc *GenreController) RenameGenre(c *gin.Context) {
+	genreId := c.Query("genreId")
+	if genreId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "genreId is required"})
+		return
+	}
+
+	var req models.Genre
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	genre, err := gc.GenreService.RenameGenre(genreId, req.Name)
+	if err != nil {
+		c.JSON(genreErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genre": genre})
+}
+
+func (gc *GenreController) DeleteGenre(c *gin.Context) {
+	genreId := c.Query("genreId")
+	if genreId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "genreId is required"})
+		return
+	}
+
+	err := gc.GenreService.DeleteGenre(genreId)
+	if err != nil {
+		c.JSON(genreErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Genre deleted"})
+}
+
+func (gc *GenreController) MergeGenres(c *gin.Context) {
+	genreId := c.Query("genreId")
+	intoGenreId := c.Query("intoGenreId")
+	if genreId == "" || intoGenreId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "genreId and intoGenreId are required"})
+		return
+	}
+
+	genre, err := gc.GenreService.MergeGenres(genreId, intoGenreId)
+	if err != nil {
+		c.JSON(genreErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Genres merged", "genre": genre})
+}
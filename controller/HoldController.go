@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HoldController struct {
+	HoldService *services.HoldService
+}
+
+func NewHoldController(holdService *services.HoldService) *HoldController {
+	return &HoldController{
+		holdService,
+	}
+}
+
+// holdStatus maps hold service errors to HTTP status codes.
+func holdStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not verified"), strings.Contains(err.Error(), "rated for ages"),
+		strings.Contains(err.Error(), "years old"):
+		return http.StatusForbidden
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "not enough seats"), strings.Contains(err.Error(), "already taken"),
+		strings.Contains(err.Error(), "expired"), strings.Contains(err.Error(), "already started"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "failed to"), strings.Contains(err.Error(), "error fetching"):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func (hc *HoldController) CreateHold(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	var request models.HoldRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.ShowtimeId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "showtimeId is required"})
+		return
+	}
+
+	hold, err := hc.HoldService.CreateHold(userId, &request)
+	if err != nil {
+		c.JSON(holdStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hold": hold})
+}
+
+func (hc *HoldController) GetHold(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	holdId := c.Query("holdId")
+	if holdId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holdId is required"})
+		return
+	}
+
+	hold, err := hc.HoldService.GetHold(userId, holdId)
+	if err != nil {
+		c.JSON(holdStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hold": hold})
+}
+
+func (hc *HoldController) ExtendHold(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	holdId := c.Query("holdId")
+	if holdId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holdId is required"})
+		return
+	}
+
+	hold, err := hc.HoldService.ExtendHold(userId, holdId)
+	if err != nil {
+		c.JSON(holdStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hold": hold})
+}
+
+func (hc *HoldController) ReleaseHold(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	holdId := c.Query("holdId")
+	if holdId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holdId is required"})
+		return
+	}
+
+	err := hc.HoldService.ReleaseHold(userId, holdId)
+	if err != nil {
+		c.JSON(holdStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hold released successfully"})
+}
+
+func (hc *HoldController) ConvertHold(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
+	holdId := c.Query("holdId")
+	if holdId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holdId is required"})
+		return
+	}
+
+	reservation, err := hc.HoldService.ConvertHold(userId, holdId)
+	if err != nil {
+		c.JSON(holdStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reservation": reservation})
+}
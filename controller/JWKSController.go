@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"movie/keyring"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct {
+	AccessKeys *keyring.Keyring
+}
+
+func NewJWKSController(accessKeys *keyring.Keyring) *JWKSController {
+	return &JWKSController{
+		accessKeys,
+	}
+}
+
+// GetJWKS publishes the public access token keys, so other services can verify
+// access tokens without sharing a secret.
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": jc.AccessKeys.PublicKeys()})
+}
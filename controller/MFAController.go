@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAController struct {
+	MFAService *services.MFAService
+}
+
+func NewMFAController(mfaService *services.MFAService) *MFAController {
+	return &MFAController{
+		mfaService,
+	}
+}
+
+type mfaCode struct {
+	Code string `json:"code"`
+}
+
+// mfaStatus maps two-factor service errors to HTTP status codes.
+func mfaStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "too many"):
+		return http.StatusTooManyRequests
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusUnauthorized
+	case strings.Contains(err.Error(), "mandatory"):
+		return http.StatusForbidden
+	case strings.Contains(err.Error(), "already enabled"), strings.Contains(err.Error(), "not enabled"),
+		strings.Contains(err.Error(), "enroll first"):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (mc *MFAController) Enroll(c *gin.Context) {
+	enrollment, err := mc.MFAService.Enroll(c.GetString("UserId"), c.GetString("Email"))
+	if err != nil {
+		c.JSON(mfaStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enrollment": enrollment})
+}
+
+func (mc *MFAController) Confirm(c *gin.Context) {
+	var body mfaCode
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	codes, err := mc.MFAService.Confirm(c.GetString("UserId"), body.Code)
+	if err != nil {
+		c.JSON(mfaStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recoveryCodes": codes,
+	})
+}
+
+func (mc *MFAController) Disable(c *gin.Context) {
+	var body mfaCode
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	err := mc.MFAService.Disable(c.GetString("UserId"), body.Code)
+	if err != nil {
+		c.JSON(mfaStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	var body mfaCode
+	if err := c.ShouldBindJSON(&body); err != nil || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	codes, err := mc.MFAService.RegenerateRecoveryCodes(c.GetString("UserId"), body.Code)
+	if err != nil {
+		c.JSON(mfaStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (mc *MFAController) VerifyLogin(c *gin.Context) {
+	var body struct {
+		MfaToken string `json:"mfaToken"`
+		Code     string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.MfaToken == "" || body.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfaToken and code are required"})
+		return
+	}
+
+	user, accessToken, refreshToken, err := mc.MFAService.VerifyLogin(body.MfaToken, body.Code, clientOf(c))
+	if err != nil {
+		c.JSON(mfaStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshCookie(c, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"token": accessToken,
+	})
+}
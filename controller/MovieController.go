@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	"fmt"
 	"movie/models"
 	"movie/services"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,7 +31,12 @@ func (mc *MovieController) AddMovie(c *gin.Context) {
 
 	movie, err := mc.MovieService.AddMovie(&newMovie)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unknown") || strings.Contains(err.Error(), "must") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -60,13 +68,124 @@ func (mc *MovieController) DeleteMovie(c *gin.Context) {
 }
 
 func (mc *MovieController) GetMovies(c *gin.Context) {
-	movies, err := mc.MovieService.GetMovies()
+	filter, err := movieFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, pageSize := pageParams(c)
+
+	movies, err := mc.MovieService.GetMovies(filter, page, pageSize)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unknown") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": "Failed to fetch movies: " + err.Error()})
+		return
+	}
+
+	movies.Next = nextPageLink(c, movies.Pagination)
+	c.JSON(http.StatusOK, movies)
+}
+
+func (mc *MovieController) SearchMovies(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	page, pageSize := pageParams(c)
+
+	results, err := mc.MovieService.SearchMovies(query, page, pageSize)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "empty") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	results.Next = nextPageLink(c, results.Pagination)
+	c.JSON(http.StatusOK, results)
+}
+
+func (mc *MovieController) GetContentRatings(c *gin.Context) {
+	ratings, err := mc.MovieService.GetContentRatings()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movies: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"movies": movies})
+	c.JSON(http.StatusOK, gin.H{"contentRatings": ratings})
+}
+
+func (mc *MovieController) SetContentRating(c *gin.Context) {
+	var rating models.ContentRating
+	if err := c.ShouldBindJSON(&rating); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := mc.MovieService.SetContentRating(&rating)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "must") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contentRating": updated})
+}
+
+// movieFilter reads the catalogue filters from the query. Release dates are
+// YYYY-MM-DD and both ends of the range are inclusive.
+func movieFilter(c *gin.Context) (models.MovieFilter, error) {
+	filter := models.MovieFilter{
+		Genre:    c.Query("genre"),
+		Director: c.Query("director"),
+		Status:   c.Query("status"),
+		Sort:     c.Query("sort"),
+	}
+
+	if value := c.Query("releasedFrom"); value != "" {
+		from, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return filter, fmt.Errorf("releasedFrom must be a date like 2024-12-31")
+		}
+		filter.ReleasedFrom = &from
+	}
+	if value := c.Query("releasedTo"); value != "" {
+		to, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return filter, fmt.Errorf("releasedTo must be a date like 2024-12-31")
+		}
+		// up to the end of that day
+		to = to.Add(24*time.Hour - time.Microsecond)
+		filter.ReleasedTo = &to
+	}
+
+	var err error
+	if value := c.Query("minDuration"); value != "" {
+		if filter.MinDuration, err = strconv.Atoi(value); err != nil || filter.MinDuration < 0 {
+			return filter, fmt.Errorf("minDuration must be a number of minutes")
+		}
+	}
+	if value := c.Query("maxDuration"); value != "" {
+		if filter.MaxDuration, err = strconv.Atoi(value); err != nil || filter.MaxDuration < 0 {
+			return filter, fmt.Errorf("maxDuration must be a number of minutes")
+		}
+	}
+
+	return filter, nil
 }
 
 func (mc *MovieController) UpdateMovies(c *gin.Context) {
@@ -83,7 +202,12 @@ func (mc *MovieController) UpdateMovies(c *gin.Context) {
 
 	movie, err := mc.MovieService.UpdateMovies(&updatedMovie)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "unknown") || strings.Contains(err.Error(), "must") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PersonController struct {
+	PersonService *services.PersonService
+}
+
+func NewPersonController(personService *services.PersonService) *PersonController {
+	return &PersonController{
+		personService,
+	}
+}
+
+// personErrorStatus maps person and credit service errors to HTTP statuses.
+func personErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.Contains(err.Error(), "already exists"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "must") || strings.Contains(err.Error(), "only"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (pc *PersonController) GetPeople(c *gin.Context) {
+	page, pageSize := pageParams(c)
+
+	people, err := pc.PersonService.GetPeople(c.Query("search"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	people.Next = nextPageLink(c, people.Pagination)
+	c.JSON(http.StatusOK, people)
+}
+
+func (pc *PersonController) GetFilmography(c *gin.Context) {
+	personId := c.Query("personId")
+	if personId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personId is required"})
+		return
+	}
+
+	filmography, err := pc.PersonService.GetFilmography(personId)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, filmography)
+}
+
+func (pc *PersonController) AddPerson(c *gin.Context) {
+	var person models.Person
+	if err := c.ShouldBindJSON(&person); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	added, err := pc.PersonService.AddPerson(&person)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"person": added})
+}
+
+func (pc *PersonController) UpdatePerson(c *gin.Context) {
+	var person models.Person
+	if err := c.ShouldBindJSON(&person); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if person.PersonId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personId is required"})
+		return
+	}
+
+	updated, err := pc.PersonService.UpdatePerson(&person)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"person": updated})
+}
+
+func (pc *PersonController) DeletePerson(c *gin.Context) {
+	personId := c.Query("personId")
+	if personId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "personId is required"})
+		return
+	}
+
+	err := pc.PersonService.DeletePerson(personId)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Person deleted"})
+}
+
+func (pc *PersonController) AddCredit(c *gin.Context) {
+	var credit models.Credit
+	if err := c.ShouldBindJSON(&credit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	added, err := pc.PersonService.AddCredit(&credit)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"credit": added})
+}
+
+func (pc *PersonController) DeleteCredit(c *gin.Context) {
+	creditId := c.Query("creditId")
+	if creditId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "creditId is required"})
+		return
+	}
+
+	err := pc.PersonService.DeleteCredit(creditId)
+	if err != nil {
+		c.JSON(personErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Credit deleted"})
+}
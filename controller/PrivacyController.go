@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrivacyController struct {
+	PrivacyService *services.PrivacyService
+}
+
+func NewPrivacyController(privacyService *services.PrivacyService) *PrivacyController {
+	return &PrivacyController{
+		privacyService,
+	}
+}
+
+// sendExport answers with the export as a JSON file download.
+func (pc *PrivacyController) sendExport(c *gin.Context, userId string) {
+	export, err := pc.PrivacyService.Export(userId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("personal-data-%s-%s.json", userId, export.ExportedAt.Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// erased answers an erasure request with the outcome of the erasure.
+func (pc *PrivacyController) erased(c *gin.Context, err error) {
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "don't hold"), strings.Contains(err.Error(), "own account"):
+			status = http.StatusForbidden
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Personal data erased"})
+}
+
+func (pc *PrivacyController) ExportOwnData(c *gin.Context) {
+	pc.sendExport(c, c.GetString("UserId"))
+}
+
+// EraseOwnAccount needs the current password, a stolen access token alone
+// can't wipe an account.
+func (pc *PrivacyController) EraseOwnAccount(c *gin.Context) {
+	var body struct {
+		CurrentPassword string `json:"currentPassword"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.CurrentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currentPassword is required"})
+		return
+	}
+
+	userId := c.GetString("UserId")
+	if err := helpers.CheckCurrentPassword(pc.PrivacyService.DB, userId, body.CurrentPassword); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "incorrect") {
+			status = http.StatusForbidden
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearRefreshCookie(c)
+	pc.erased(c, pc.PrivacyService.Erase(userId))
+}
+
+func (pc *PrivacyController) ExportUserData(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	pc.sendExport(c, userId)
+}
+
+func (pc *PrivacyController) EraseUser(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	pc.erased(c, pc.PrivacyService.EraseUser(userId, c.GetString("UserId"), heldPermissions(c)))
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"movie/middlewares"
 	"movie/models"
 	"movie/services"
 	"net/http"
@@ -21,13 +22,12 @@ func NewReservationServiceController(reservationService *services.ReservationSer
 }
 
 func (rc *ReservationController) GetUpcomingReservations(c *gin.Context) {
-	userId := c.Query("userId")
-	if userId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+	userId, ok := currentUserId(c)
+	if !ok {
 		return
 	}
 
-	reservations, err := rc.ReservationService.GetUpcomingEvents(userId)
+	reservations, err := rc.ReservationService.GetUpcomingEvents(userId.String())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -63,19 +63,28 @@ func (rc *ReservationController) GetUserReservations(c *gin.Context) {
 }
 
 func (rc *ReservationController) CancelReservation(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
 	reservationId := c.Query("reservationId")
 	if reservationId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "reservationId is required"})
 		return
 	}
 
-	err := rc.ReservationService.CancelReservation(reservationId)
+	err := rc.ReservationService.CancelReservation(reservationId, userId)
 	if err != nil {
 		status := http.StatusBadRequest
 		switch {
 		case strings.Contains(err.Error(), "not found"):
 			status = http.StatusNotFound
-		case strings.Contains(err.Error(), "delete reservation"):
+		case strings.Contains(err.Error(), "another user"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "already cancelled"), strings.Contains(err.Error(), "cannot be cancelled"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "cancelling reservation"), strings.Contains(err.Error(), "failed to"):
 			status = http.StatusInternalServerError
 		}
 
@@ -83,28 +92,57 @@ func (rc *ReservationController) CancelReservation(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Reservation deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation cancelled successfully"})
 }
 
 func (rc *ReservationController) BookSeats(c *gin.Context) {
+	userId, ok := currentUserId(c)
+	if !ok {
+		return
+	}
+
 	var bookingData models.BookingData
 	if err := c.ShouldBindJSON(&bookingData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if bookingData.ShowtimeId == "" || bookingData.UserId == uuid.Nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Need both showtimeId and userId"})
+	if bookingData.ShowtimeId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "showtimeId is required"})
 		return
 	}
 
+	// Bookings belong to the token's user unless staff books on behalf of a customer
+	if bookingData.UserId == uuid.Nil {
+		bookingData.UserId = userId
+	} else if bookingData.UserId != userId {
+		if denied := middlewares.StaffAccessDenied(c, models.PermReservationsBookForOthers); denied != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot book seats for another user: " + denied})
+			return
+		}
+	}
+
 	if bookingData.Seats < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "seats should be a positive integer"})
+		return
 	}
 
 	reservation, err := rc.ReservationService.BookSeats(&bookingData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "not verified"), strings.Contains(err.Error(), "rated for ages"),
+			strings.Contains(err.Error(), "years old"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "not enough seats"), strings.Contains(err.Error(), "already taken"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "required"), strings.Contains(err.Error(), "not available"),
+			strings.Contains(err.Error(), "not found"), strings.Contains(err.Error(), "no seat map"),
+			strings.Contains(err.Error(), "positive integer"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
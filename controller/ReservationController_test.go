@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"encoding/json"
+	"movie/internal/testutil"
+	"movie/middlewares"
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// serve runs handler for a request authenticated as userId, with any other
+// context values the auth middleware would set.
+func serve(handler gin.HandlerFunc, userId uuid.UUID, session gin.H, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, "/", func(c *gin.Context) {
+		c.Set("UserId", userId.String())
+		c.Set("Role", "user")
+		for key, value := range session {
+			c.Set(key, value)
+		}
+		handler(c)
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+type rolePermissions map[string][]string
+
+func (rp rolePermissions) HasPermission(role, permission string) (bool, error) {
+	return slices.Contains(rp[role], permission), nil
+}
+
+func TestBookSeatsForAnotherUserIsForbidden(t *testing.T) {
+	middlewares.UsePermissionChecker(rolePermissions{
+		"box_office": {models.PermReservationsBookForOthers},
+	})
+	t.Cleanup(func() { middlewares.UsePermissionChecker(nil) })
+
+	// Refused before the database is touched
+	rc := NewReservationServiceController(&services.ReservationService{})
+
+	tests := []struct {
+		name    string
+		session gin.H
+		error   string
+	}{
+		{"customer", nil, "Missing permission"},
+		{"customer with two-factor", gin.H{"Mfa": true}, "Missing permission"},
+		{"staff without two-factor", gin.H{"Role": "box_office"}, "two-factor"},
+		{"api key without scope", gin.H{"Role": "box_office", "Mfa": true, "ApiKeyPermissions": []string{}}, "Missing permission"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"showtimeId": "abc", "seats": 1, "userId": "` + uuid.New().String() + `"}`
+			recorder := serve(rc.BookSeats, uuid.New(), tt.session, http.MethodPost, "/", body)
+
+			if recorder.Code != http.StatusForbidden {
+				t.Fatalf("expected %d, got %d: %s", http.StatusForbidden, recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), "cannot book seats for another user") ||
+				!strings.Contains(recorder.Body.String(), tt.error) {
+				t.Errorf("unexpected error: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestCancelReservationOfAnotherUserIsForbidden(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+	rc := NewReservationServiceController(rs)
+
+	showtimeId := testutil.Showtime(t, db, 5)
+	ownerId := testutil.User(t, db)
+	otherId := testutil.User(t, db)
+
+	reservation, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: ownerId, Seats: 1})
+	if err != nil {
+		t.Fatalf("failed to book seats: %v", err)
+	}
+
+	target := "/?reservationId=" + reservation.ReservationId
+	recorder := serve(rc.CancelReservation, otherId, nil, http.MethodPost, target, "")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d: %s", http.StatusForbidden, recorder.Code, recorder.Body)
+	}
+
+	recorder = serve(rc.CancelReservation, ownerId, nil, http.MethodPost, target, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the owner to cancel, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestUpcomingReservationsOnlyListOwn(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+	rc := NewReservationServiceController(rs)
+
+	showtimeId := testutil.Showtime(t, db, 5)
+	ownerId := testutil.User(t, db)
+	otherId := testutil.User(t, db)
+
+	for _, userId := range []uuid.UUID{ownerId, otherId} {
+		_, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+		if err != nil {
+			t.Fatalf("failed to book seats: %v", err)
+		}
+	}
+
+	recorder := serve(rc.GetUpcomingReservations, ownerId, nil, http.MethodPost, "/", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Reservations []models.Reservation `json:"reservations"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Reservations) != 1 {
+		t.Errorf("expected 1 reservation, got %d", len(response.Reservations))
+	}
+	for _, reservation := range response.Reservations {
+		if reservation.UserId != ownerId {
+			t.Errorf("got reservation %s of user %s", reservation.ReservationId, reservation.UserId)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	PermissionService *services.PermissionService
+}
+
+func NewRoleController(permissionService *services.PermissionService) *RoleController {
+	return &RoleController{
+		permissionService,
+	}
+}
+
+func (rc *RoleController) GetRoles(c *gin.Context) {
+	roles, err := rc.PermissionService.GetRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (rc *RoleController) SetRolePermissions(c *gin.Context) {
+	var role models.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := rc.PermissionService.SetRolePermissions(&role, heldPermissions(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "don't hold"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "can't be granted") ||
+			strings.Contains(err.Error(), "must"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"role": updated})
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SSOController struct {
+	SSOService *services.SSOService
+}
+
+func NewSSOController(ssoService *services.SSOService) *SSOController {
+	return &SSOController{
+		ssoService,
+	}
+}
+
+// ssoStateCookie binds a login to the browser that started it, so an attacker
+// can't get a victim's browser to finish the attacker's login (login CSRF).
+const ssoStateCookie = "ssoState"
+
+// Login sends the browser to the identity provider.
+func (sc *SSOController) Login(c *gin.Context) {
+	authURL, state, err := sc.SSOService.BeginLogin()
+	if err != nil {
+		status := http.StatusBadGateway
+		if strings.Contains(err.Error(), "not configured") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetCookie(ssoStateCookie, state, int(services.SSOLoginTTL.Seconds()), "/account/sso", "", false, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback is the redirect URL registered at the identity provider.
+func (sc *SSOController) Callback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sso login failed: " + providerError + " " + c.Query("error_description")})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	cookieState, _ := c.Cookie(ssoStateCookie)
+	c.SetCookie(ssoStateCookie, "", -1, "/account/sso", "", false, true)
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sso login wasn't started in this browser"})
+		return
+	}
+
+	user, accessToken, refreshToken, err := sc.SSOService.CompleteLogin(code, state, clientOf(c))
+	if err != nil {
+		var mfaRequired *services.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			c.JSON(http.StatusOK, gin.H{
+				"mfaRequired": true,
+				"mfaToken":    mfaRequired.Token,
+			})
+			return
+		}
+
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "not configured"):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrAccountSuspended):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "invalid or expired") || strings.Contains(err.Error(), "sso login failed"):
+			status = http.StatusUnauthorized
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshCookie(c, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"token": accessToken,
+	})
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestSSOCallbackRequiresStateCookie(t *testing.T) {
+	// Refused before the provider or the database are asked
+	sc := NewSSOController(&services.SSOService{})
+
+	tests := []struct {
+		name   string
+		cookie string // "" sends no cookie
+	}{
+		{"no cookie", ""},
+		{"other login's state", "attacker-state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/account/sso/callback", sc.Callback)
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/account/sso/callback?code=code-1&state=victim-state", nil)
+			if tt.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: ssoStateCookie, Value: tt.cookie})
+			}
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("expected %d, got %d: %s", http.StatusUnauthorized, recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), "wasn't started in this browser") {
+				t.Errorf("unexpected error: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestSSOLoginSetsStateCookie(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	ss, mock := testutil.SSOService(t, db)
+	sc := NewSSOController(ss)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/account/sso/login", sc.Login)
+	router.GET("/account/sso/callback", sc.Callback)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/account/sso/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusFound, recorder.Code, recorder.Body)
+	}
+
+	var stateCookie *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == ssoStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || !stateCookie.HttpOnly {
+		t.Fatalf("expected an HttpOnly %s cookie, got %v", ssoStateCookie, recorder.Result().Cookies())
+	}
+
+	email := testutil.Email(t, db)
+	code, state, err := mock.Authorize(recorder.Header().Get("Location"), jwt.MapClaims{
+		"sub":            uuid.New().String(),
+		"email":          email,
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatalf("provider refused the auth request: %v", err)
+	}
+	if state != stateCookie.Value {
+		t.Fatalf("cookie %q doesn't hold the state %q", stateCookie.Value, state)
+	}
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/account/sso/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	request.AddCookie(stateCookie)
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+}
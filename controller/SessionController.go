@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"movie/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	TokenService *services.TokenService
+}
+
+func NewSessionController(tokenService *services.TokenService) *SessionController {
+	return &SessionController{
+		tokenService,
+	}
+}
+
+func (sc *SessionController) GetSessions(c *gin.Context) {
+	sessions, err := sc.TokenService.GetSessions(c.GetString("UserId"), c.GetString("SessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	sessionId := c.Query("sessionId")
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sessionId is required"})
+		return
+	}
+
+	err := sc.TokenService.RevokeSession(c.GetString("UserId"), sessionId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if sessionId == c.GetString("SessionId") {
+		clearRefreshCookie(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
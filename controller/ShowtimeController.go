@@ -56,7 +56,16 @@ func (sc *ShowtimeController) UpdateShowtime(c *gin.Context) {
 
 	showtime, err := sc.ShowtimeService.UpdateShowtime(&updatedShowtime)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "can't be set"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -104,25 +113,22 @@ func (sc *ShowtimeController) GetShowtimeAndMovie(c *gin.Context) {
 }
 
 func (sc *ShowtimeController) CheckAvailableSeats(c *gin.Context) {
-	movieId := c.Query("movieId")
-	if movieId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "MovieId is required and cannot be empty"})
+	showtimeId := c.Query("showtimeId")
+	if showtimeId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "showtimeId is required and cannot be empty"})
 		return
 	}
 
-	seatsAndPriceData, err := sc.ShowtimeService.CheckAvailableSeats(movieId)
+	seatMap, err := sc.ShowtimeService.GetSeatMap(showtimeId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
 
-	if seatsAndPriceData.AvailableSeats == 0 {
-		c.JSON(http.StatusOK, gin.H{"message": "No seats available for that movie"})
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"Free seats":     seatsAndPriceData.AvailableSeats,
-		"Price per seat": seatsAndPriceData.PricePerSeat,
-	})
+	c.JSON(http.StatusOK, gin.H{"seatMap": seatMap})
 }
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"movie/models"
 	"movie/services"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,23 +30,34 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	user, accessToken, refreshToken, err := uc.UserService.Login(&credentials)
+	user, accessToken, refreshToken, err := uc.UserService.Login(&credentials, clientOf(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		var mfaRequired *services.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			c.JSON(http.StatusOK, gin.H{
+				"mfaRequired": true,
+				"mfaToken":    mfaRequired.Token,
+			})
+			return
+		}
+
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, services.ErrAccountSuspended):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "too many"):
+			status = http.StatusTooManyRequests
+		case !strings.Contains(err.Error(), "invalid email or password"):
+			status = http.StatusInternalServerError
+		}
+
+		c.JSON(status, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
 
-	c.SetCookie(
-		"refreshToken", // cookie name
-		refreshToken,   // value
-		7*24*60*60,     // maxAge in seconds (7 days)
-		"/",            // path
-		"",             // domain (empty = current domain)
-		false,          // secure (set true in production with HTTPS)
-		true,           // httpOnly (can't be accessed by JS)
-	)
+	setRefreshCookie(c, refreshToken)
 
 	c.JSON(http.StatusOK, gin.H{
 		"user":  user,
@@ -61,22 +74,19 @@ func (uc *UserController) Signup(c *gin.Context) {
 		return
 	}
 
-	createdUser, accessToken, refreshToken, err := uc.UserService.Signup(&user)
+	createdUser, accessToken, refreshToken, err := uc.UserService.Signup(&user, clientOf(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "date of birth") {
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	c.SetCookie(
-		"refreshToken", // cookie name
-		refreshToken,   // value
-		7*24*60*60,     // maxAge in seconds (7 days)
-		"/",            // path
-		"",             // domain (empty = current domain)
-		false,          // secure (set true in production with HTTPS)
-		true,           // httpOnly (can't be accessed by JS)
-	)
+	setRefreshCookie(c, refreshToken)
 
 	c.JSON(http.StatusOK, gin.H{
 		"user":  createdUser,
@@ -84,6 +94,217 @@ func (uc *UserController) Signup(c *gin.Context) {
 	})
 }
 
+func (uc *UserController) Refresh(c *gin.Context) {
+	refreshToken, err := c.Cookie("refreshToken")
+	if err != nil || refreshToken == "" {
+		var body struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh token is required"})
+			return
+		}
+		refreshToken = body.RefreshToken
+	}
+
+	user, accessToken, newRefreshToken, err := uc.UserService.Refresh(refreshToken, clientOf(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid refresh token") {
+			status = http.StatusUnauthorized
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshCookie(c, newRefreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"token": accessToken,
+	})
+}
+
+func (uc *UserController) Logout(c *gin.Context) {
+	if c.GetString("TokenId") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API keys have no session to log out of, revoke the key instead"})
+		return
+	}
+
+	refreshToken, _ := c.Cookie("refreshToken")
+
+	err := uc.UserService.Logout(c.GetString("UserId"), c.GetString("TokenId"), c.GetString("SessionId"), c.GetTime("TokenExpiresAt"), refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (uc *UserController) LogoutAll(c *gin.Context) {
+	err := uc.UserService.LogoutAll(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+func (uc *UserController) RequestPasswordReset(c *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+
+	err := uc.UserService.RequestPasswordReset(body.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email belongs to an account, a reset link has been sent"})
+}
+
+func (uc *UserController) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and newPassword are required"})
+		return
+	}
+
+	err := uc.UserService.ResetPassword(body.Token, body.NewPassword)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "invalid or expired"):
+			status = http.StatusUnauthorized
+		case strings.Contains(err.Error(), "password must"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in again"})
+}
+
+func (uc *UserController) VerifyEmail(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	err := uc.UserService.VerifyEmail(body.Token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid or expired") {
+			status = http.StatusUnauthorized
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func (uc *UserController) ResendVerification(c *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+
+	err := uc.UserService.ResendVerification(body.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email belongs to an unverified account, a new link has been sent"})
+}
+
+func (uc *UserController) MarkVerified(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	err := uc.UserService.MarkVerified(userId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User verified"})
+}
+
+func (uc *UserController) UnlockAccount(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	err := uc.UserService.UnlockAccount(userId, c.Query("ip"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
+func (uc *UserController) AssignRole(c *gin.Context) {
+	userId := c.Query("userId")
+	role := c.Query("role")
+	if userId == "" || role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId and role are required"})
+		return
+	}
+
+	err := uc.UserService.AssignRole(userId, role)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned, the user has to log in again"})
+}
+
 func (uc *UserController) PromoteToAdmin(c *gin.Context) {
 	userId := c.Query("userId")
 	if userId == "" {
@@ -108,3 +329,270 @@ func (uc *UserController) PromoteToAdmin(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "User promoted to admin"})
 }
+
+func (uc *UserController) GetUsers(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	includeDeleted := c.Query("includeDeleted") == "true"
+
+	users, err := uc.UserService.GetUsers(c.Query("search"), page, pageSize, includeDeleted)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	users.Next = nextPageLink(c, users.Pagination)
+	c.JSON(http.StatusOK, users)
+}
+
+func (uc *UserController) Demote(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	err := uc.UserService.Demote(userId)
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "already a regular user"):
+			status = http.StatusConflict
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User demoted, the user has to log in again"})
+}
+
+func (uc *UserController) Suspend(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+	}
+
+	err := uc.UserService.Suspend(userId, body.Reason, c.GetString("UserId"), heldPermissions(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "don't hold"), strings.Contains(err.Error(), "own account"):
+			status = http.StatusForbidden
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended"})
+}
+
+func (uc *UserController) Unsuspend(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	err := uc.UserService.Unsuspend(userId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended"})
+}
+
+func (uc *UserController) SetDateOfBirth(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	var body struct {
+		DateOfBirth *time.Time `json:"dateOfBirth"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.DateOfBirth == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dateOfBirth is required"})
+		return
+	}
+
+	err := uc.UserService.SetDateOfBirth(userId, *body.DateOfBirth)
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "must"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Date of birth updated"})
+}
+
+func (uc *UserController) DeleteUser(c *gin.Context) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "soft")
+	if mode != "soft" && mode != "hard" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be soft or hard"})
+		return
+	}
+
+	err := uc.UserService.DeleteUser(userId, mode == "hard", c.GetString("UserId"), heldPermissions(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "don't hold"), strings.Contains(err.Error(), "own account"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "past reservations"):
+			status = http.StatusConflict
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+func (uc *UserController) GetProfile(c *gin.Context) {
+	user, err := uc.UserService.GetProfile(c.GetString("UserId"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (uc *UserController) UpdateProfile(c *gin.Context) {
+	var update models.ProfileUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, err := uc.UserService.UpdateProfile(c.GetString("UserId"), &update)
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "name must"), strings.Contains(err.Error(), "date of birth must"):
+			status = http.StatusBadRequest
+		case strings.Contains(err.Error(), "already set"):
+			status = http.StatusConflict
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	var change models.PasswordChange
+	if err := c.ShouldBindJSON(&change); err != nil || change.CurrentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currentPassword and newPassword are required"})
+		return
+	}
+
+	user, accessToken, refreshToken, err := uc.UserService.ChangePassword(c.GetString("UserId"), &change, c.GetBool("Mfa"), clientOf(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "current password is incorrect"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "password must"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshCookie(c, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed, other sessions have been logged out",
+		"user":    user,
+		"token":   accessToken,
+	})
+}
+
+func (uc *UserController) ChangeEmail(c *gin.Context) {
+	var change models.EmailChange
+	if err := c.ShouldBindJSON(&change); err != nil || change.CurrentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currentPassword and newEmail are required"})
+		return
+	}
+
+	user, accessToken, refreshToken, err := uc.UserService.ChangeEmail(c.GetString("UserId"), &change, c.GetBool("Mfa"), clientOf(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		switch {
+		case strings.Contains(err.Error(), "current password is incorrect"):
+			status = http.StatusForbidden
+		case strings.Contains(err.Error(), "already taken"):
+			status = http.StatusConflict
+		case strings.Contains(err.Error(), "email"):
+			status = http.StatusBadRequest
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshCookie(c, refreshToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed, confirm the new address with the link we sent",
+		"user":    user,
+		"token":   accessToken,
+	})
+}
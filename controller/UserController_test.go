@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginOfSuspendedAccountIsForbidden(t *testing.T) {
+	db := testutil.DB(t)
+
+	userId := testutil.User(t, db)
+	password, err := helpers.HashPassword("correct-password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	var email string
+	suspendQuery := `
+	UPDATE users SET password = $2, suspendedat = CURRENT_TIMESTAMP
+	WHERE userid = $1 RETURNING email
+	`
+	if err = db.Get(&email, suspendQuery, userId.String(), password); err != nil {
+		t.Fatalf("failed to suspend user: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM login_failures WHERE key = $1`, services.AccountKey(email)) })
+
+	attempts := services.NewLoginAttemptService(db)
+	tokens := services.NewTokenService(db, services.NewMemoryRevocationStore())
+	mfa := services.NewMFAService(db, tokens, attempts)
+	uc := NewUserController(services.NewuserService(db, tokens, mfa, attempts, nil))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/account/login", uc.Login)
+
+	body := `{"email": "` + email + `", "password": "correct-password"}`
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/account/login", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d: %s", http.StatusForbidden, recorder.Code, recorder.Body)
+	}
+	if !strings.Contains(recorder.Body.String(), services.ErrAccountSuspended.Error()) {
+		t.Errorf("unexpected error: %s", recorder.Body)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"movie/helpers"
+	"movie/middlewares"
+	"movie/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// currentUserId returns the acting user put in the context by the auth middleware.
+// It answers the request itself when the token carries no usable user id.
+func currentUserId(c *gin.Context) (uuid.UUID, bool) {
+	userId, err := uuid.Parse(c.GetString("UserId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user in token"})
+		return uuid.Nil, false
+	}
+	return userId, true
+}
+
+// heldPermissions tells the services which permissions the acting user holds,
+// for staff actions limited to what the staff member may do themselves.
+func heldPermissions(c *gin.Context) func(permission string) bool {
+	return func(permission string) bool {
+		return middlewares.HasPermission(c, permission)
+	}
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams reads the page and pageSize query parameters, falling back to the
+// first page of defaultPageSize entries.
+func pageParams(c *gin.Context) (page, pageSize int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err = strconv.Atoi(c.Query("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize
+}
+
+// nextPageLink returns the request's URL for the page after p, or "" if p is
+// the last page.
+func nextPageLink(c *gin.Context, p models.Pagination) string {
+	if p.Page*p.PageSize >= p.Total {
+		return ""
+	}
+
+	query := c.Request.URL.Query()
+	query.Set("page", strconv.Itoa(p.Page+1))
+	query.Set("pageSize", strconv.Itoa(p.PageSize))
+
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// clientOf describes where the request came from, for session tracking.
+func clientOf(c *gin.Context) models.Client {
+	return models.Client{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+func setRefreshCookie(c *gin.Context, refreshToken string) {
+	c.SetCookie(
+		"refreshToken",                         // cookie name
+		refreshToken,                           // value
+		int(helpers.RefreshTokenTTL.Seconds()), // maxAge in seconds (7 days)
+		"/",                                    // path
+		"",                                     // domain (empty = current domain)
+		false,                                  // secure (set true in production with HTTPS)
+		true,                                   // httpOnly (can't be accessed by JS)
+	)
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	c.SetCookie("refreshToken", "", -1, "/", "", false, true)
+}
@@ -1,6 +1,14 @@
 package helpers
 
-import "github.com/jmoiron/sqlx"
+import (
+	"fmt"
+	"net/mail"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxEmailLength matches the users.email column.
+const MaxEmailLength = 50
 
 func IsEmailAvailable(db *sqlx.DB, email string) (bool, error) {
 	var count int
@@ -19,3 +27,24 @@ func IsUserIdAvailable(db *sqlx.DB, userId string) (bool, error) {
 	}
 	return count == 0, nil // true = available
 }
+
+func IsUserVerified(db *sqlx.DB, userId string) (bool, error) {
+	var verified bool
+	err := db.QueryRow("SELECT verified FROM users WHERE userid = $1", userId).Scan(&verified)
+	if err != nil {
+		return false, err
+	}
+	return verified, nil
+}
+
+// ValidateEmail accepts a bare address like name@example.com.
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return fmt.Errorf("invalid email address")
+	}
+	if len(email) > MaxEmailLength {
+		return fmt.Errorf("email must be at most %d characters long", MaxEmailLength)
+	}
+	return nil
+}
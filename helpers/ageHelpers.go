@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// AgeOn returns how many full years old someone born on birthDate is on day.
+func AgeOn(birthDate, day time.Time) int {
+	age := day.Year() - birthDate.Year()
+	if day.Month() < birthDate.Month() || (day.Month() == birthDate.Month() && day.Day() < birthDate.Day()) {
+		age--
+	}
+	return age
+}
+
+// ValidateDateOfBirth rejects dates in the future or too far back to be real.
+func ValidateDateOfBirth(birthDate time.Time) error {
+	if birthDate.After(time.Now()) {
+		return fmt.Errorf("date of birth must not be in the future")
+	}
+	if birthDate.Year() < 1900 {
+		return fmt.Errorf("date of birth must be after 1900")
+	}
+	return nil
+}
+
+// CheckAgeRestriction makes sure the user is old enough for the rating of the
+// movie on the day of the show. It reports whether door staff have to check ID,
+// which is the case for every age-restricted movie.
+func CheckAgeRestriction(tx *sqlx.Tx, movieId string, userId uuid.UUID, showDay time.Time) (bool, error) {
+	var minimumAge int
+	ratingQuery := `
+	SELECT COALESCE(cr.minimumage, 0)
+	FROM movies m
+	LEFT JOIN content_ratings cr ON cr.ratingsystem = m.ratingsystem AND cr.rating = m.rating
+	WHERE m.movieid = $1
+	`
+	err := tx.Get(&minimumAge, ratingQuery, movieId)
+	if err != nil {
+		return false, fmt.Errorf("error fetching movie rating: %w", err)
+	}
+	if minimumAge == 0 {
+		return false, nil
+	}
+
+	var birthDate *time.Time
+	err = tx.Get(&birthDate, `SELECT dateofbirth FROM users WHERE userid = $1`, userId)
+	if err != nil {
+		return false, fmt.Errorf("error fetching user: %w", err)
+	}
+	if birthDate == nil {
+		return false, fmt.Errorf("this film is rated for ages %d and up, add your date of birth to your profile first", minimumAge)
+	}
+
+	if AgeOn(*birthDate, showDay) < minimumAge {
+		return false, fmt.Errorf("you must be at least %d years old to see this film", minimumAge)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package helpers_test
+
+import (
+	"movie/helpers"
+	"testing"
+	"time"
+)
+
+func TestAgeOn(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		birthDate time.Time
+		day       time.Time
+		want      int
+	}{
+		{"birthday before the show day", date(2008, time.March, 10), date(2025, time.March, 11), 17},
+		{"birthday on the show day", date(2008, time.March, 10), date(2025, time.March, 10), 17},
+		{"birthday after the show day", date(2008, time.March, 10), date(2025, time.March, 9), 16},
+		{"birthday later in the year", date(2008, time.December, 1), date(2025, time.March, 10), 16},
+		{"newborn", date(2025, time.March, 10), date(2025, time.March, 10), 0},
+		// Without a 29 February, the birthday counts from 1 March
+		{"29 February, on 28 February of a non-leap year", date(2008, time.February, 29), date(2025, time.February, 28), 16},
+		{"29 February, on 1 March of a non-leap year", date(2008, time.February, 29), date(2025, time.March, 1), 17},
+		{"29 February, on 29 February of a leap year", date(2008, time.February, 29), date(2028, time.February, 29), 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := helpers.AgeOn(tt.birthDate, tt.day); got != tt.want {
+				t.Errorf("AgeOn(%s, %s) = %d, want %d", tt.birthDate.Format(time.DateOnly), tt.day.Format(time.DateOnly), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package helpers
+
+import "strings"
+
+// DescribeDevice turns a User-Agent header into a short label like
+// "Firefox on Windows" for session listings. It only knows common clients.
+func DescribeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	client := "Unknown browser"
+	for _, c := range []struct{ marker, name string }{
+		// Order matters, most browsers also claim to be Safari or Chrome
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"okhttp/", "Android app"},
+		{"Go-http-client/", "Go client"},
+	} {
+		if strings.Contains(userAgent, c.marker) {
+			client = c.name
+			break
+		}
+	}
+
+	for _, p := range []struct{ marker, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.marker) {
+			return client + " on " + p.name
+		}
+	}
+
+	return client
+}
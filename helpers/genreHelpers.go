@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"strings"
+	"unicode"
+)
+
+// GenreSlug normalizes a genre name so that spelling variants compare equal:
+// "Sci-Fi", "sci fi" and " SCI/FI " all become "sci-fi".
+func GenreSlug(name string) string {
+	var slug strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	return slug.String()
+}
@@ -1,9 +1,18 @@
 package helpers
 
 import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const MinPasswordLength = 8
+
+// dummyHash is compared against when a login names an unknown account, so the
+// response takes as long as for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -16,3 +25,31 @@ func CheckPasswords(enteredPassword, storedPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(enteredPassword))
 	return err == nil
 }
+
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
+	}
+	return nil
+}
+
+// CheckDummyPassword spends the same time as CheckPasswords and always fails.
+func CheckDummyPassword(enteredPassword string) bool {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(enteredPassword))
+	return false
+}
+
+// CheckCurrentPassword confirms a sensitive change with the user's password.
+func CheckCurrentPassword(db *sqlx.DB, userId, password string) error {
+	var hashedPassword string
+	err := db.Get(&hashedPassword, `SELECT password FROM users WHERE userid = $1 AND deletedat IS NULL`, userId)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if !CheckPasswords(password, hashedPassword) {
+		return fmt.Errorf("current password is incorrect")
+	}
+
+	return nil
+}
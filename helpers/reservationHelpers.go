@@ -1,9 +1,12 @@
 package helpers
 
 import (
+	"fmt"
 	"movie/models"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 func GetShowtimeData(db *sqlx.DB, showtimeId string) (*models.Showtime, error) {
@@ -18,3 +21,241 @@ func GetShowtimeData(db *sqlx.DB, showtimeId string) (*models.Showtime, error) {
 
 	return &showtime, nil
 }
+
+// LockShowtime reads a showtime and locks its row until the transaction ends, so
+// concurrent bookings for the same showtime are serialized.
+func LockShowtime(tx *sqlx.Tx, showtimeId string) (*models.Showtime, error) {
+	var showtime models.Showtime
+	query := `
+	SELECT * FROM showtimes WHERE showtimeid = $1 FOR UPDATE
+	`
+	err := tx.Get(&showtime, query, showtimeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &showtime, nil
+}
+
+// EnsureNotStarted refuses holding seats of a showtime that has already begun.
+func EnsureNotStarted(showtime *models.Showtime) error {
+	if !showtime.StartTime.After(time.Now()) {
+		return fmt.Errorf("showtime has already started")
+	}
+	return nil
+}
+
+// TakeSeats decrements the available seats of a showtime, failing instead of
+// going below zero.
+func TakeSeats(tx *sqlx.Tx, showtimeId string, seats int) error {
+	query := `
+	UPDATE showtimes
+	SET availableseats = availableseats - $2
+	WHERE showtimeid = $1 AND availableseats >= $2
+	`
+	result, err := tx.Exec(query, showtimeId, seats)
+	if err != nil {
+		return fmt.Errorf("failed to update available seats: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update available seats: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("not enough seats available")
+	}
+
+	return nil
+}
+
+// SeatCount works out how many seats a request takes. Mapped auditoriums sell
+// concrete seats, so the count follows from the selection there.
+func SeatCount(showtime *models.Showtime, seatIds []string, seats int) (int, error) {
+	if showtime.AuditoriumId != nil {
+		if len(seatIds) == 0 {
+			return 0, fmt.Errorf("seatIds are required for this showtime")
+		}
+		seats = len(seatIds)
+	} else if len(seatIds) > 0 {
+		return 0, fmt.Errorf("this showtime has no seat map, book a number of seats instead")
+	}
+
+	if seats <= 0 {
+		return 0, fmt.Errorf("seats should be a positive integer")
+	}
+
+	if showtime.AvailableSeats < seats {
+		return 0, fmt.Errorf("not enough seats available, only %d are left", showtime.AvailableSeats)
+	}
+
+	return seats, nil
+}
+
+// UniqueSeatIds drops duplicate and empty ids while keeping the original order.
+func UniqueSeatIds(seatIds []string) []string {
+	seen := make(map[string]bool, len(seatIds))
+	unique := make([]string, 0, len(seatIds))
+	for _, id := range seatIds {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// GetSellableSeats returns the requested seats of an auditorium, failing if any of
+// them does not belong to it or is disabled.
+func GetSellableSeats(tx *sqlx.Tx, auditoriumId string, seatIds []string) ([]models.Seat, error) {
+	var seats []models.Seat
+	query := `
+	SELECT * FROM seats
+	WHERE auditoriumid = $1 AND seatid = ANY($2)
+	ORDER BY rowindex, seatnumber
+	`
+	err := tx.Select(&seats, query, auditoriumId, pq.Array(seatIds))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching seats: %w", err)
+	}
+
+	if len(seats) != len(seatIds) {
+		return nil, fmt.Errorf("some seats were not found in this auditorium")
+	}
+
+	for _, seat := range seats {
+		if seat.Disabled {
+			return nil, fmt.Errorf("seat %s%d is not available for sale", seat.RowLabel, seat.SeatNumber)
+		}
+	}
+
+	return seats, nil
+}
+
+// EnsureSeatsFree fails if any of the seats is already reserved or held for the
+// showtime. Seats held by exceptHoldId are treated as free.
+func EnsureSeatsFree(tx *sqlx.Tx, showtimeId string, seatIds []string, exceptHoldId string) error {
+	var taken []string
+	takenQuery := `
+	SELECT seatid FROM reservation_seats
+	WHERE showtimeid = $1 AND seatid = ANY($2) AND releasedat IS NULL
+	UNION
+	SELECT hs.seatid FROM seat_hold_seats hs
+	JOIN seat_holds h ON h.holdid = hs.holdid
+	WHERE hs.showtimeid = $1 AND hs.seatid = ANY($2)
+	  AND h.status = 'active' AND h.holdid <> $3
+	`
+	err := tx.Select(&taken, takenQuery, showtimeId, pq.Array(seatIds), exceptHoldId)
+	if err != nil {
+		return fmt.Errorf("error checking taken seats: %w", err)
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("seats already taken: %v", taken)
+	}
+
+	return nil
+}
+
+// SeatIdsOf returns the ids of the given seats.
+func SeatIdsOf(seats []models.Seat) []string {
+	seatIds := make([]string, len(seats))
+	for i, seat := range seats {
+		seatIds[i] = seat.SeatId
+	}
+	return seatIds
+}
+
+// InsertReservation stores a new reservation and reads back the stored row.
+func InsertReservation(tx *sqlx.Tx, reservation *models.Reservation) error {
+	insertQuery := `
+		INSERT INTO reservations (reservationid, userid, showtimeid, numberofseats, totalprice, reservationdate, idcheckrequired)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *
+	`
+	err := tx.Get(reservation, insertQuery,
+		reservation.ReservationId,
+		reservation.UserId,
+		reservation.ShowtimeId,
+		reservation.NumberOfSeats,
+		reservation.TotalPrice,
+		reservation.ReservationDate,
+		reservation.IdCheckRequired,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert reservation: %w", err)
+	}
+
+	return nil
+}
+
+// AssignSeats links the given seats to a reservation. Callers check availability
+// with EnsureSeatsFree first.
+func AssignSeats(tx *sqlx.Tx, showtimeId, reservationId string, seats []models.Seat) error {
+	insertQuery := `
+	INSERT INTO reservation_seats (reservationid, showtimeid, seatid)
+	VALUES ($1, $2, $3)
+	`
+	for _, seat := range seats {
+		_, err := tx.Exec(insertQuery, reservationId, showtimeId, seat.SeatId)
+		if err != nil {
+			return fmt.Errorf("failed to assign seat %s%d: %w", seat.RowLabel, seat.SeatNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// GetReservationSeats returns the seats linked to a reservation.
+func GetReservationSeats(db sqlx.Queryer, reservationId string) ([]models.Seat, error) {
+	var seats []models.Seat
+	query := `
+	SELECT s.* FROM seats s
+	JOIN reservation_seats rs ON rs.seatid = s.seatid
+	WHERE rs.reservationid = $1
+	ORDER BY s.rowindex, s.seatnumber
+	`
+	err := sqlx.Select(db, &seats, query, reservationId)
+	if err != nil {
+		return nil, err
+	}
+
+	return seats, nil
+}
+
+// ReleaseReservation marks a reservation as cancelled, frees its seats and adds
+// them back to the showtime's available seats.
+func ReleaseReservation(tx *sqlx.Tx, reservation *models.Reservation) error {
+	cancelQuery := `
+	UPDATE reservations
+	SET status = 'cancelled', cancelledat = CURRENT_TIMESTAMP
+	WHERE reservationid = $1
+	`
+	_, err := tx.Exec(cancelQuery, reservation.ReservationId)
+	if err != nil {
+		return fmt.Errorf("error cancelling reservation: %w", err)
+	}
+
+	releaseQuery := `
+	UPDATE reservation_seats
+	SET releasedat = CURRENT_TIMESTAMP
+	WHERE reservationid = $1 AND releasedat IS NULL
+	`
+	_, err = tx.Exec(releaseQuery, reservation.ReservationId)
+	if err != nil {
+		return fmt.Errorf("error cancelling reservation: %w", err)
+	}
+
+	seatsQuery := `
+	UPDATE showtimes
+	SET availableseats = availableseats + $2
+	WHERE showtimeid = $1
+	`
+	_, err = tx.Exec(seatsQuery, reservation.ShowtimeId, reservation.NumberOfSeats)
+	if err != nil {
+		return fmt.Errorf("error cancelling reservation: %w", err)
+	}
+
+	reservation.Status = models.ReservationCancelled
+	return nil
+}
@@ -0,0 +1,11 @@
+package helpers
+
+import "strings"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike makes a search term match itself literally inside a LIKE or ILIKE
+// pattern, so "%" or "_" typed by a user aren't wildcards.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
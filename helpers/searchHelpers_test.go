@@ -0,0 +1,26 @@
+package helpers_test
+
+import (
+	"movie/helpers"
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"Nolan", "Nolan"},
+		{"%", `\%`},
+		{"_", `\_`},
+		{`50%_off\`, `50\%\_off\\`},
+		{`\%`, `\\\%`},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := helpers.EscapeLike(tt.search); got != tt.want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", tt.search, got, tt.want)
+		}
+	}
+}
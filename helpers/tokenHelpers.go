@@ -1,32 +1,235 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"movie/keyring"
 	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func GenerateAccessToken(userid, email, role string) (string, error) {
-	claims := jwt.MapClaims{
-		"UserId": userid,
-		"Email":  email,
-		"Role":   role,
-		"exp":    time.Now().Add(15 * time.Minute).Unix(),
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+)
+
+// Token types, carried in the "typ" claim. Only access tokens open protected routes.
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeRefresh    = "refresh"
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+// ErrWrongTokenType is returned for a valid token of another type, e.g. a
+// refresh token presented as an access token.
+var ErrWrongTokenType = errors.New("wrong token type")
+
+// TokenClaims are the claims of every token this service issues. Which of the
+// optional ones are set depends on Type.
+type TokenClaims struct {
+	UserId     string `json:"UserId"`
+	Email      string `json:"Email,omitempty"`
+	Role       string `json:"Role,omitempty"`
+	Mfa        bool   `json:"Mfa,omitempty"`
+	Type       string `json:"typ"`
+	Generation int    `json:"gen,omitempty"`
+	FamilyId   string `json:"fid,omitempty"`
+	SessionId  string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Issuer is the "iss" of all tokens, JWT_ISSUER or "movie-reservation".
+func Issuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
 	}
+	return "movie-reservation"
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+// AccessAudience is the "aud" of access tokens, JWT_AUDIENCE or "movie-api".
+// Refresh and mfa pending tokens are only ever read by the issuer and carry
+// the issuer as their audience.
+func AccessAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return "movie-api"
+}
+
+var accessKeys, refreshKeys *keyring.Keyring
+
+// UseKeyrings sets the keys access (and mfa pending) tokens and refresh tokens
+// are signed and verified with.
+func UseKeyrings(access, refresh *keyring.Keyring) {
+	accessKeys = access
+	refreshKeys = refresh
+}
+
+// newClaims fills in the registered claims of a new token.
+func newClaims(typ, userId, tokenId, audience string, expiresAt time.Time) TokenClaims {
+	return TokenClaims{
+		UserId: userId,
+		Type:   typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Issuer:    Issuer(),
+			Subject:   userId,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
 }
 
-func GenerateRefreshToken(userid, email, role string) (string, error) {
-	claims := jwt.MapClaims{
-		"UserId": userid,
-		"Email":  email,
-		"Role":   role,
-		"exp":    time.Now().Add(7 * 24 * time.Minute).Unix(),
+// signToken signs the claims with the active key of the ring and names the key
+// in the "kid" header.
+func signToken(keys *keyring.Keyring, claims TokenClaims) (string, error) {
+	if keys == nil {
+		return "", fmt.Errorf("signing keys are not configured")
+	}
+
+	key := keys.Signer()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.SignKey)
+}
+
+// parseToken verifies signature, issuer, audience, expiry and type of a token.
+func parseToken(keys *keyring.Keyring, tokenStr, typ, audience string) (*TokenClaims, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("signing keys are not configured")
+	}
+
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.VerificationKey(kid, token.Method.Alg())
+	},
+		jwt.WithValidMethods(keyring.Algorithms),
+		jwt.WithIssuer(Issuer()),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != typ {
+		return nil, fmt.Errorf("%w: not %s token", ErrWrongTokenType, typ)
+	}
+	if claims.UserId == "" || claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing user or token id", jwt.ErrTokenInvalidClaims)
+	}
+
+	return claims, nil
+}
+
+// GenerateAccessToken signs an access token. sessionId is the refresh token
+// family the token belongs to. generation is the user's token generation at
+// issue time, bumping it revokes every older token. mfa records whether the
+// login passed a second factor.
+func GenerateAccessToken(userid, email, role, sessionId string, generation int, mfa bool) (string, error) {
+	claims := newClaims(TokenTypeAccess, userid, uuid.New().String(), AccessAudience(), time.Now().Add(AccessTokenTTL))
+	claims.Email = email
+	claims.Role = role
+	claims.Mfa = mfa
+	claims.Generation = generation
+	claims.SessionId = sessionId
+
+	return signToken(accessKeys, claims)
+}
+
+// ParseAccessToken verifies an access token and returns its claims.
+func ParseAccessToken(tokenStr string) (*TokenClaims, error) {
+	claims, err := parseToken(accessKeys, tokenStr, TokenTypeAccess, AccessAudience())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Email == "" || claims.Role == "" {
+		return nil, fmt.Errorf("%w: missing email or role", jwt.ErrTokenInvalidClaims)
+	}
+
+	return claims, nil
+}
+
+// GenerateMFAToken signs the short-lived token a login returns when a second
+// factor is still missing. It can only be exchanged at /account/mfa/verify.
+func GenerateMFAToken(userid string) (string, error) {
+	claims := newClaims(TokenTypeMFAPending, userid, uuid.New().String(), Issuer(), time.Now().Add(MFATokenTTL))
+	return signToken(accessKeys, claims)
+}
+
+// ParseMFAToken verifies an mfa pending token and returns its id, user and expiry.
+func ParseMFAToken(tokenStr string) (tokenId, userId string, expiresAt time.Time, err error) {
+	claims, err := parseToken(accessKeys, tokenStr, TokenTypeMFAPending, Issuer())
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("invalid mfa token: %v", err)
+	}
+
+	return claims.ID, claims.UserId, claims.ExpiresAt.Time, nil
+}
+
+// GenerateRefreshToken signs a refresh token. tokenId identifies this token and
+// familyId the chain of tokens rotated from the same login.
+func GenerateRefreshToken(userid, email, role, tokenId, familyId string, expiresAt time.Time) (string, error) {
+	claims := newClaims(TokenTypeRefresh, userid, tokenId, Issuer(), expiresAt)
+	claims.Email = email
+	claims.Role = role
+	claims.FamilyId = familyId
+
+	return signToken(refreshKeys, claims)
+}
+
+// ParseRefreshToken verifies a refresh token against the refresh keys and returns
+// its token and family ids and the user it was issued to.
+func ParseRefreshToken(tokenStr string) (tokenId, familyId, userId string, err error) {
+	claims, err := parseToken(refreshKeys, tokenStr, TokenTypeRefresh, Issuer())
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid refresh token: %v", err)
+	}
+	if claims.FamilyId == "" {
+		return "", "", "", fmt.Errorf("invalid refresh token claims")
+	}
+
+	return claims.ID, claims.FamilyId, claims.UserId, nil
+}
+
+// GenerateOpaqueToken returns a random single-use token for links sent by email,
+// and the hash that is stored in its place.
+func GenerateOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token = hex.EncodeToString(buf)
+	return token, HashOpaqueToken(token), nil
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix marks API keys, so leaked keys are easy to recognise in logs and scans.
+const APIKeyPrefix = "mrk_"
+
+// GenerateAPIKey returns a new API key, the short prefix that identifies it in
+// listings, and the hash that is stored in its place.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	token, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("REFRESH_SECRET")))
+	key = APIKeyPrefix + token
+	return key, key[:len(APIKeyPrefix)+8], HashOpaqueToken(key), nil
 }
@@ -0,0 +1,246 @@
+package helpers_test
+
+import (
+	"errors"
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/keyring"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims are the claims of a valid access token.
+func accessClaims() helpers.TokenClaims {
+	return helpers.TokenClaims{
+		UserId: "user-1",
+		Email:  "user@example.com",
+		Role:   "user",
+		Type:   helpers.TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			Issuer:    helpers.Issuer(),
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{helpers.AccessAudience()},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(helpers.AccessTokenTTL)),
+		},
+	}
+}
+
+// signHS256 signs claims with secret under the kid, bypassing the keyrings.
+func signHS256(t *testing.T, claims jwt.Claims, kid, secret string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestParseAccessToken(t *testing.T) {
+	testutil.Keyrings(t, helpers.UseKeyrings)
+
+	signed := func(modify func(*helpers.TokenClaims)) func(t *testing.T) string {
+		return func(t *testing.T) string {
+			claims := accessClaims()
+			modify(&claims)
+			return signHS256(t, claims, keyring.LegacyKeyId, testutil.AccessSecret)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		err   error // nil for valid tokens, otherwise the expected error kind
+	}{
+		{
+			name:  "valid",
+			token: signed(func(*helpers.TokenClaims) {}),
+		},
+		{
+			name:  "malformed",
+			token: func(*testing.T) string { return "not.a.token" },
+			err:   jwt.ErrTokenMalformed,
+		},
+		{
+			name:  "empty",
+			token: func(*testing.T) string { return "" },
+			err:   jwt.ErrTokenMalformed,
+		},
+		{
+			name: "expired",
+			token: signed(func(claims *helpers.TokenClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			}),
+			err: jwt.ErrTokenExpired,
+		},
+		{
+			name:  "missing exp",
+			token: signed(func(claims *helpers.TokenClaims) { claims.ExpiresAt = nil }),
+			err:   jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name: "issued in the future",
+			token: signed(func(claims *helpers.TokenClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+			}),
+			err: jwt.ErrTokenUsedBeforeIssued,
+		},
+		{
+			name: "refresh token",
+			token: func(t *testing.T) string {
+				token, err := helpers.GenerateRefreshToken("user-1", "user@example.com", "user", "token-1", "family-1", time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatalf("failed to sign token: %v", err)
+				}
+				return token
+			},
+			err: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:  "refresh type signed with the access keys",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Type = helpers.TokenTypeRefresh }),
+			err:   helpers.ErrWrongTokenType,
+		},
+		{
+			name: "mfa pending token",
+			token: func(t *testing.T) string {
+				token, err := helpers.GenerateMFAToken("user-1")
+				if err != nil {
+					t.Fatalf("failed to sign token: %v", err)
+				}
+				return token
+			},
+			err: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:  "mfa pending type with the access audience",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Type = helpers.TokenTypeMFAPending }),
+			err:   helpers.ErrWrongTokenType,
+		},
+		{
+			name:  "missing type",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Type = "" }),
+			err:   helpers.ErrWrongTokenType,
+		},
+		{
+			name:  "wrong issuer",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Issuer = "someone-else" }),
+			err:   jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:  "wrong audience",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Audience = jwt.ClaimStrings{"other-api"} }),
+			err:   jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:  "missing role",
+			token: signed(func(claims *helpers.TokenClaims) { claims.Role = "" }),
+			err:   jwt.ErrTokenInvalidClaims,
+		},
+		{
+			name:  "missing token id",
+			token: signed(func(claims *helpers.TokenClaims) { claims.ID = "" }),
+			err:   jwt.ErrTokenInvalidClaims,
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				claims := accessClaims()
+				return signHS256(t, claims, "unknown", testutil.AccessSecret)
+			},
+			err: jwt.ErrTokenUnverifiable,
+		},
+		{
+			name: "wrong secret",
+			token: func(t *testing.T) string {
+				claims := accessClaims()
+				return signHS256(t, claims, keyring.LegacyKeyId, "guessed-secret")
+			},
+			err: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				claims := accessClaims()
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+				signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatalf("failed to sign token: %v", err)
+				}
+				return signed
+			},
+			err: jwt.ErrTokenSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := helpers.ParseAccessToken(tt.token(t))
+
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("expected a valid token, got %v", err)
+				}
+				if claims.UserId != "user-1" || claims.Type != helpers.TokenTypeAccess {
+					t.Errorf("unexpected claims %+v", claims)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if claims != nil {
+				t.Errorf("expected no claims, got %+v", claims)
+			}
+		})
+	}
+}
+
+func TestParseMFAToken(t *testing.T) {
+	testutil.Keyrings(t, helpers.UseKeyrings)
+
+	mfaToken, err := helpers.GenerateMFAToken("user-1")
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	accessToken, err := helpers.GenerateAccessToken("user-1", "user@example.com", "user", "session-1", 0, false)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"mfa pending token", mfaToken, true},
+		{"access token", accessToken, false},
+		{"malformed", "not.a.token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, userId, _, err := helpers.ParseMFAToken(tt.token)
+			if tt.valid {
+				if err != nil || userId != "user-1" {
+					t.Fatalf("expected a valid token of user-1, got %q, %v", userId, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid mfa token") {
+				t.Fatalf("expected an invalid mfa token error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package testutil holds the fixtures shared by the tests of several packages.
+// Database fixtures need POSTGRES_DSN to point at a database with the schema
+// from the README; tests using them are skipped when it is unset.
+package testutil
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// DB connects to the database in POSTGRES_DSN, or skips the test.
+func DB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN is not set")
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err = db.Ping(); err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// User inserts a verified customer without a date of birth and removes it,
+// along with its reservations and holds, when the test ends.
+func User(t *testing.T, db *sqlx.DB) uuid.UUID {
+	t.Helper()
+
+	userId := uuid.New()
+	query := `
+	INSERT INTO users (userid, name, email, password, verified)
+	VALUES ($1, 'Test User', $2, 'not-a-hash', true)
+	`
+	_, err := db.Exec(query, userId.String(), userId.String()[:18]+"@example.com")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM reservations WHERE userid = $1`, userId.String())
+		db.Exec(`DELETE FROM seat_holds WHERE userid = $1`, userId.String())
+		db.Exec(`DELETE FROM users WHERE userid = $1`, userId.String())
+	})
+
+	return userId
+}
+
+// Showtime inserts an unrated movie with a general admission showtime
+// tomorrow, so bookings and cancellations are both allowed.
+func Showtime(t *testing.T, db *sqlx.DB, seats int) string {
+	t.Helper()
+
+	movieId := uuid.New().String()[:10]
+	movieQuery := `
+	INSERT INTO movies (movieid, title, duration, director, posterimage, releasedate)
+	VALUES ($1, 'Test Movie', 90, 'Test Director', 'poster.jpg', CURRENT_TIMESTAMP)
+	`
+	if _, err := db.Exec(movieQuery, movieId); err != nil {
+		t.Fatalf("failed to create movie: %v", err)
+	}
+
+	showtimeId := uuid.New().String()[:10]
+	start := time.Now().Add(24 * time.Hour)
+	showtimeQuery := `
+	INSERT INTO showtimes (showtimeid, movieid, starttime, endtime, venue, priceperseat, availableseats)
+	VALUES ($1, $2, $3, $4, 'Test Venue', 10, $5)
+	`
+	_, err := db.Exec(showtimeQuery, showtimeId, movieId, start, start.Add(90*time.Minute), seats)
+	if err != nil {
+		t.Fatalf("failed to create showtime: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM reservations WHERE showtimeid = $1`, showtimeId)
+		db.Exec(`DELETE FROM showtimes WHERE showtimeid = $1`, showtimeId)
+		db.Exec(`DELETE FROM movies WHERE movieid = $1`, movieId)
+	})
+
+	return showtimeId
+}
+
+// DateOfBirth sets the user's date of birth.
+func DateOfBirth(t *testing.T, db *sqlx.DB, userId uuid.UUID, birthDate time.Time) {
+	t.Helper()
+
+	_, err := db.Exec(`UPDATE users SET dateofbirth = $2 WHERE userid = $1`, userId.String(), birthDate)
+	if err != nil {
+		t.Fatalf("failed to set date of birth: %v", err)
+	}
+}
+
+// Rate gives the movie of the showtime an MPAA rating, e.g. "R" for 17 and up.
+func Rate(t *testing.T, db *sqlx.DB, showtimeId, rating string) {
+	t.Helper()
+
+	query := `
+	UPDATE movies SET ratingsystem = 'MPAA', rating = $2
+	WHERE movieid = (SELECT movieid FROM showtimes WHERE showtimeid = $1)
+	`
+	if _, err := db.Exec(query, showtimeId, rating); err != nil {
+		t.Fatalf("failed to rate movie: %v", err)
+	}
+}
+
+// Email returns a unique address and deletes its account, if one gets created,
+// when the test ends.
+func Email(t *testing.T, db *sqlx.DB) string {
+	email := uuid.New().String()[:18] + "@example.com"
+	t.Cleanup(func() { db.Exec(`DELETE FROM users WHERE email = $1`, email) })
+	return email
+}
+
+// AvailableSeats is the seat counter of the showtime.
+func AvailableSeats(t *testing.T, db *sqlx.DB, showtimeId string) int {
+	t.Helper()
+
+	var seats int
+	err := db.Get(&seats, `SELECT availableseats FROM showtimes WHERE showtimeid = $1`, showtimeId)
+	if err != nil {
+		t.Fatalf("failed to fetch available seats: %v", err)
+	}
+	return seats
+}
+
+// BookedSeats sums the seats of the showtime's confirmed reservations.
+func BookedSeats(t *testing.T, db *sqlx.DB, showtimeId string) int {
+	t.Helper()
+
+	var seats int
+	query := `
+	SELECT COALESCE(SUM(numberofseats), 0) FROM reservations
+	WHERE showtimeid = $1 AND status = 'confirmed'
+	`
+	if err := db.Get(&seats, query, showtimeId); err != nil {
+		t.Fatalf("failed to count booked seats: %v", err)
+	}
+	return seats
+}
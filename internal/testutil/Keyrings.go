@@ -0,0 +1,33 @@
+package testutil
+
+import (
+	"movie/keyring"
+	"testing"
+)
+
+// Secrets of the legacy HS256 keys Keyrings sets up, for tests that sign their
+// own tokens.
+const (
+	AccessSecret  = "access-secret"
+	RefreshSecret = "refresh-secret"
+)
+
+// Keyrings passes HS256 access and refresh keyrings to use, which is
+// helpers.UseKeyrings, and unsets them when the test ends.
+func Keyrings(t *testing.T, use func(access, refresh *keyring.Keyring)) {
+	t.Helper()
+
+	t.Setenv("TEST_ACCESS_SECRET", AccessSecret)
+	t.Setenv("TEST_REFRESH_SECRET", RefreshSecret)
+	access, err := keyring.FromEnv("TEST_ACCESS")
+	if err != nil {
+		t.Fatalf("failed to load access keys: %v", err)
+	}
+	refresh, err := keyring.FromEnv("TEST_REFRESH")
+	if err != nil {
+		t.Fatalf("failed to load refresh keys: %v", err)
+	}
+
+	use(access, refresh)
+	t.Cleanup(func() { use(nil, nil) })
+}
@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"movie/oidc"
+	"movie/oidc/oidctest"
+	"movie/services"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// OIDCProvider starts a mock identity provider and returns it with a client
+// configured for it.
+func OIDCProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider("movie-reservation")
+	if err != nil {
+		t.Fatalf("failed to start provider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+
+	return mock, &oidc.Provider{
+		Issuer:      mock.URL,
+		ClientID:    mock.ClientID,
+		RedirectURL: "http://localhost:8000/account/sso/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		GroupsClaim: "groups",
+		Client:      mock.Client(),
+	}
+}
+
+// SSOService returns an SSOService logging in through a mock provider. Tokens
+// need the keyrings set up with Keyrings.
+func SSOService(t *testing.T, db *sqlx.DB, groupRoles ...services.GroupRole) (*services.SSOService, *oidctest.Provider) {
+	t.Helper()
+
+	mock, provider := OIDCProvider(t)
+	tokens := services.NewTokenService(db, services.NewMemoryRevocationStore())
+	mfa := services.NewMFAService(db, tokens, services.NewLoginAttemptService(db))
+
+	ss := services.NewSSOService(db, provider, tokens, mfa)
+	ss.GroupRoles = groupRoles
+	return ss, mock
+}
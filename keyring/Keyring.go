@@ -0,0 +1,247 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Supported signing algorithms, named as in the JWT "alg" header.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var Algorithms = []string{HS256, RS256, EdDSA}
+
+// LegacyKeyId is the id of the key made from <NAME>_SECRET. Tokens without a
+// "kid" header were signed before key ids existed and are checked against it.
+const LegacyKeyId = "legacy"
+
+// Key is one signing key. Keys that are only kept to verify tokens signed
+// before a rotation have no SignKey.
+type Key struct {
+	Id        string
+	Algorithm string
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// Keyring holds the keys of one token kind. New tokens are signed with the
+// active key; every key in the ring is accepted when verifying, so keys can be
+// rotated without logging anyone out.
+type Keyring struct {
+	activeId string
+	keys     map[string]*Key
+	ids      []string
+}
+
+// FromEnv builds the keyring configured for name, e.g. "ACCESS":
+//
+//	ACCESS_KEYS="2025-06:EdDSA:keys/access-2025-06.pem,2025-01:HS256:<secret>"
+//	ACCESS_KEY_ID=2025-06
+//	ACCESS_SECRET=<secret>   // optional, the pre-rotation key with id "legacy"
+//
+// HS256 entries hold the secret itself, RS256 and EdDSA entries the path of a
+// PEM file. A private key file can sign, a public key file only verifies.
+// ACCESS_KEY_ID picks the signing key; it defaults to the legacy key, or to the
+// only signing key there is.
+func FromEnv(name string) (*Keyring, error) {
+	kr := &Keyring{keys: map[string]*Key{}}
+
+	if secret := os.Getenv(name + "_SECRET"); secret != "" {
+		kr.add(&Key{Id: LegacyKeyId, Algorithm: HS256, SignKey: []byte(secret), VerifyKey: []byte(secret)})
+	}
+
+	for _, spec := range strings.Split(os.Getenv(name+"_KEYS"), ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		key, err := parseKeySpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s_KEYS: %w", name, err)
+		}
+		if _, exists := kr.keys[key.Id]; exists {
+			return nil, fmt.Errorf("%s_KEYS: duplicate key id %s", name, key.Id)
+		}
+		kr.add(key)
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, fmt.Errorf("no %s keys configured, set %s_SECRET or %s_KEYS", strings.ToLower(name), name, name)
+	}
+
+	kr.activeId = os.Getenv(name + "_KEY_ID")
+	if kr.activeId == "" {
+		kr.activeId = kr.defaultSigner()
+	}
+
+	active, ok := kr.keys[kr.activeId]
+	if !ok || active.SignKey == nil {
+		return nil, fmt.Errorf("%s_KEY_ID must name a key that can sign", name)
+	}
+
+	return kr, nil
+}
+
+func (kr *Keyring) add(key *Key) {
+	kr.keys[key.Id] = key
+	kr.ids = append(kr.ids, key.Id)
+}
+
+func (kr *Keyring) defaultSigner() string {
+	if _, ok := kr.keys[LegacyKeyId]; ok {
+		return LegacyKeyId
+	}
+
+	var signers []string
+	for _, id := range kr.ids {
+		if kr.keys[id].SignKey != nil {
+			signers = append(signers, id)
+		}
+	}
+	if len(signers) == 1 {
+		return signers[0]
+	}
+	return ""
+}
+
+// parseKeySpec reads one "kid:alg:value" entry.
+func parseKeySpec(spec string) (*Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid key %q, expected kid:alg:value", spec)
+	}
+
+	key := &Key{Id: parts[0], Algorithm: parts[1]}
+	switch key.Algorithm {
+	case HS256:
+		key.SignKey = []byte(parts[2])
+		key.VerifyKey = []byte(parts[2])
+		return key, nil
+	case RS256, EdDSA:
+		if err := loadPEM(key, parts[2]); err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.Id, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %s", key.Id, key.Algorithm)
+	}
+}
+
+// loadPEM reads a PKCS#8 / PKCS#1 private key or a PKIX public key.
+func loadPEM(key *Key, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s is not a PEM file", path)
+	}
+
+	var parsed interface{}
+	if parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if parsed, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return fmt.Errorf("%s holds no supported key", path)
+			}
+		}
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.SignKey, key.VerifyKey = k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.VerifyKey = k
+	case ed25519.PrivateKey:
+		key.SignKey, key.VerifyKey = k, k.Public().(ed25519.PublicKey)
+	case ed25519.PublicKey:
+		key.VerifyKey = k
+	default:
+		return fmt.Errorf("%s holds an unsupported key type %T", path, parsed)
+	}
+
+	_, isRSA := key.VerifyKey.(*rsa.PublicKey)
+	if isRSA != (key.Algorithm == RS256) {
+		return fmt.Errorf("%s doesn't hold an %s key", path, key.Algorithm)
+	}
+
+	return nil
+}
+
+// Signer returns the key new tokens are signed with.
+func (kr *Keyring) Signer() *Key {
+	return kr.keys[kr.activeId]
+}
+
+// VerificationKey returns the key to check a token with, given its "kid" and
+// "alg" headers. The algorithm must be the key's own, so a public key can't be
+// passed off as an HMAC secret.
+func (kr *Keyring) VerificationKey(kid, alg string) (interface{}, error) {
+	if kid == "" {
+		kid = LegacyKeyId
+	}
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.Algorithm != alg {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", alg, kid)
+	}
+
+	return key.VerifyKey, nil
+}
+
+// JWK is the public part of a key as published in a JWKS document (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// PublicKeys returns the asymmetric keys of the ring. HMAC secrets are never
+// published, tokens signed with them can only be checked by this service.
+func (kr *Keyring) PublicKeys() []JWK {
+	jwks := []JWK{}
+	for _, id := range kr.ids {
+		key := kr.keys[id]
+		switch pub := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Algorithm,
+				Kid: key.Id,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: key.Algorithm,
+				Kid: key.Id,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return jwks
+}
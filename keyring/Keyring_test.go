@@ -0,0 +1,286 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEM stores der as a PEM block of the type in a temporary file.
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+// keyFiles writes an RSA and an Ed25519 key pair and returns their paths.
+func keyFiles(t *testing.T) (rsaPrivate, rsaPublic, edPrivate, edPublic string) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	der := func(der []byte, err error) []byte {
+		if err != nil {
+			t.Fatalf("failed to marshal key: %v", err)
+		}
+		return der
+	}
+
+	return writePEM(t, "PRIVATE KEY", der(x509.MarshalPKCS8PrivateKey(rsaKey))),
+		writePEM(t, "PUBLIC KEY", der(x509.MarshalPKIXPublicKey(&rsaKey.PublicKey))),
+		writePEM(t, "PRIVATE KEY", der(x509.MarshalPKCS8PrivateKey(edKey))),
+		writePEM(t, "PUBLIC KEY", der(x509.MarshalPKIXPublicKey(edPublicKey)))
+}
+
+// setEnv sets TEST_SECRET, TEST_KEYS and TEST_KEY_ID for the test.
+func setEnv(t *testing.T, secret, keys, keyId string) {
+	t.Setenv("TEST_SECRET", secret)
+	t.Setenv("TEST_KEYS", keys)
+	t.Setenv("TEST_KEY_ID", keyId)
+}
+
+func TestFromEnv(t *testing.T) {
+	_, rsaPublic, edPrivate, _ := keyFiles(t)
+
+	tests := []struct {
+		name   string
+		secret string
+		keys   string
+		keyId  string
+		active string // the signing key, "" if loading fails
+		err    string
+	}{
+		{name: "legacy secret only", secret: "s3cret", active: LegacyKeyId},
+		{name: "legacy secret stays active", secret: "s3cret", keys: "2025-06:HS256:new-secret", active: LegacyKeyId},
+		{name: "key id picks the signer", secret: "s3cret", keys: "2025-06:HS256:new-secret", keyId: "2025-06", active: "2025-06"},
+		{name: "only signing key", keys: "verify:RS256:" + rsaPublic + ",sign:EdDSA:" + edPrivate, active: "sign"},
+		{name: "spaces around entries", keys: " a:HS256:one , b:HS256:two ", keyId: "b", active: "b"},
+		{name: "nothing configured", err: "no test keys configured"},
+		{name: "duplicate key id", keys: "a:HS256:one,a:HS256:two", err: "duplicate key id a"},
+		{name: "legacy key id taken", secret: "s3cret", keys: "legacy:HS256:other", err: "duplicate key id legacy"},
+		{name: "missing value", keys: "a:HS256", err: "expected kid:alg:value"},
+		{name: "missing kid", keys: ":HS256:secret", err: "expected kid:alg:value"},
+		{name: "unsupported algorithm", keys: "a:HS512:secret", err: "unsupported algorithm HS512"},
+		{name: "missing key file", keys: "a:RS256:/does/not/exist.pem", err: "key a"},
+		{name: "unknown key id", keys: "a:HS256:one", keyId: "b", err: "must name a key that can sign"},
+		{name: "key id of a public key", keys: "a:RS256:" + rsaPublic, keyId: "a", err: "must name a key that can sign"},
+		{name: "no signing key at all", keys: "a:RS256:" + rsaPublic, err: "must name a key that can sign"},
+		{name: "several signers, no key id", keys: "a:HS256:one,b:HS256:two", err: "must name a key that can sign"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.secret, tt.keys, tt.keyId)
+
+			kr, err := FromEnv("TEST")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to load keyring: %v", err)
+			}
+			if kr.Signer().Id != tt.active {
+				t.Errorf("expected signing key %s, got %s", tt.active, kr.Signer().Id)
+			}
+		})
+	}
+}
+
+func TestLoadPEM(t *testing.T) {
+	rsaPrivate, rsaPublic, edPrivate, edPublic := keyFiles(t)
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		path      string
+		canSign   bool
+		err       string // "" if the key loads
+	}{
+		{name: "rsa private key", algorithm: RS256, path: rsaPrivate, canSign: true},
+		{name: "rsa public key", algorithm: RS256, path: rsaPublic},
+		{name: "ed25519 private key", algorithm: EdDSA, path: edPrivate, canSign: true},
+		{name: "ed25519 public key", algorithm: EdDSA, path: edPublic},
+		{name: "rsa key as EdDSA", algorithm: EdDSA, path: rsaPrivate, err: "doesn't hold an EdDSA key"},
+		{name: "ed25519 key as RS256", algorithm: RS256, path: edPublic, err: "doesn't hold an RS256 key"},
+		{name: "not PEM", algorithm: RS256, path: notPEM, err: "is not a PEM file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &Key{Id: "k", Algorithm: tt.algorithm}
+			err := loadPEM(key, tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to load key: %v", err)
+			}
+			if (key.SignKey != nil) != tt.canSign || key.VerifyKey == nil {
+				t.Errorf("expected canSign %v, got sign key %T and verify key %T", tt.canSign, key.SignKey, key.VerifyKey)
+			}
+		})
+	}
+}
+
+// sign signs a token with the keyring's signing key the way the token helpers do.
+func sign(t *testing.T, kr *Keyring) string {
+	t.Helper()
+
+	signer := kr.Signer()
+	claims := jwt.RegisteredClaims{Subject: "user-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(signer.Algorithm), claims)
+	token.Header["kid"] = signer.Id
+
+	signed, err := token.SignedString(signer.SignKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// verify checks a token against the keyring the way the token helpers do.
+func verify(kr *Keyring, signed string) error {
+	_, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return kr.VerificationKey(kid, token.Method.Alg())
+	}, jwt.WithValidMethods(Algorithms))
+	return err
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	rsaPrivate, _, edPrivate, _ := keyFiles(t)
+
+	setEnv(t, "", "2025-01:RS256:"+rsaPrivate, "")
+	before, err := FromEnv("TEST")
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	oldToken := sign(t, before)
+
+	// The new key signs, the old one is kept for verification
+	setEnv(t, "", "2025-06:EdDSA:"+edPrivate+",2025-01:RS256:"+rsaPrivate, "2025-06")
+	after, err := FromEnv("TEST")
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	newToken := sign(t, after)
+
+	if err = verify(after, oldToken); err != nil {
+		t.Errorf("expected a token of the old key to verify after rotation, got %v", err)
+	}
+	if err = verify(after, newToken); err != nil {
+		t.Errorf("expected a token of the new key to verify, got %v", err)
+	}
+	if err = verify(before, newToken); err == nil {
+		t.Error("expected a keyring without the new key to refuse its tokens")
+	}
+}
+
+func TestVerificationKeyRefusesAlgConfusion(t *testing.T) {
+	_, rsaPublic, _, _ := keyFiles(t)
+
+	setEnv(t, "s3cret", "rsa:RS256:"+rsaPublic, "")
+	kr, err := FromEnv("TEST")
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+
+	tests := []struct {
+		kid, alg string
+		valid    bool
+	}{
+		{"rsa", RS256, true},
+		{"", HS256, true}, // tokens from before key ids, checked against the legacy key
+		{LegacyKeyId, HS256, true},
+		{"rsa", HS256, false},
+		{"rsa", EdDSA, false},
+		{LegacyKeyId, RS256, false},
+		{"", RS256, false},
+		{"unknown", HS256, false},
+	}
+
+	for _, tt := range tests {
+		key, err := kr.VerificationKey(tt.kid, tt.alg)
+		if tt.valid != (err == nil) {
+			t.Errorf("VerificationKey(%q, %s) = %T, %v", tt.kid, tt.alg, key, err)
+		}
+	}
+
+	// The classic attack: an HS256 token signed with the public key as secret
+	publicPEM, err := os.ReadFile(rsaPublic)
+	if err != nil {
+		t.Fatalf("failed to read key: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "admin"})
+	forged.Header["kid"] = "rsa"
+	signed, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if err = verify(kr, signed); err == nil {
+		t.Error("expected an HS256 token under an RSA key id to be refused")
+	}
+}
+
+func TestPublicKeysNeverPublishSecrets(t *testing.T) {
+	_, rsaPublic, edPrivate, _ := keyFiles(t)
+
+	setEnv(t, "legacy-s3cret", "hs:HS256:hs-s3cret,rsa:RS256:"+rsaPublic+",ed:EdDSA:"+edPrivate, "ed")
+	kr, err := FromEnv("TEST")
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+
+	jwks := kr.PublicKeys()
+	var kids []string
+	for _, jwk := range jwks {
+		kids = append(kids, jwk.Kid+":"+jwk.Kty+":"+jwk.Alg)
+	}
+	if strings.Join(kids, ",") != "rsa:RSA:RS256,ed:OKP:EdDSA" {
+		t.Errorf("expected only the rsa and ed keys, got %v", kids)
+	}
+
+	published, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("failed to marshal keys: %v", err)
+	}
+	for _, secret := range []string{"legacy-s3cret", "hs-s3cret", `"d"`} {
+		if strings.Contains(string(published), secret) {
+			t.Errorf("published keys contain %s: %s", secret, published)
+		}
+	}
+}
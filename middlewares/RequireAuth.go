@@ -1,125 +1,287 @@
 package middlewares
 
 import (
-	"fmt"
+	"errors"
+	"log"
+	"movie/helpers"
+	"movie/models"
+	"movie/services"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Auth(c *gin.Context) (claims jwt.MapClaims, err error) {
+var revocations services.RevocationStore
+
+// PermissionChecker tells whether a role holds a named permission.
+type PermissionChecker interface {
+	HasPermission(role, permission string) (bool, error)
+}
+
+var permissions PermissionChecker
+
+// UsePermissionChecker sets where RequirePermission looks up role permissions.
+func UsePermissionChecker(checker PermissionChecker) {
+	permissions = checker
+}
+
+// AccountChecker tells whether a user may still use the API, i.e. is neither
+// suspended nor deleted.
+type AccountChecker interface {
+	IsActive(userId string) (bool, error)
+}
+
+var accounts AccountChecker
+
+// UseAccountChecker makes the auth middlewares reject tokens of suspended or
+// deleted accounts.
+func UseAccountChecker(checker AccountChecker) {
+	accounts = checker
+}
+
+// APIKeyAuthenticator resolves an API key to the key and the user it acts as.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*models.APIKey, *models.User, error)
+}
+
+var apiKeys APIKeyAuthenticator
+
+// UseAPIKeys makes the auth middlewares accept "Authorization: ApiKey <key>"
+// besides Bearer tokens.
+func UseAPIKeys(authenticator APIKeyAuthenticator) {
+	apiKeys = authenticator
+}
+
+// UseRevocationStore makes the auth middlewares reject revoked tokens.
+func UseRevocationStore(store services.RevocationStore) {
+	revocations = store
+}
+
+// Auth authenticates the request by its Bearer access token or API key. On
+// failure it has already answered the request and aborted it.
+func Auth(c *gin.Context) (*helpers.TokenClaims, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Authorization header required"})
-		c.Abort()
-		return nil, err
+		return nil, abort(c, http.StatusUnauthorized, "Authorization header required", nil)
 	}
 
 	parts := strings.Split(authHeader, " ")
+	if len(parts) == 2 && parts[0] == "ApiKey" && apiKeys != nil {
+		return apiKeyAuth(c, parts[1])
+	}
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Authorization header format must be Bearer {token}"})
-		c.Abort()
-		return nil, err
+		return nil, abort(c, http.StatusUnauthorized, "Authorization header format must be Bearer {token}", nil)
 	}
 
-	tokenStr := parts[1]
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	claims, err := helpers.ParseAccessToken(parts[1])
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, abort(c, http.StatusUnauthorized, "Access Token has expired", err)
+	case errors.Is(err, helpers.ErrWrongTokenType):
+		// refresh and mfa pending tokens open nothing here
+		return nil, abort(c, http.StatusUnauthorized, "Not an access token", err)
+	case err != nil:
+		return nil, abort(c, http.StatusUnauthorized, "Invalid or malformed token", err)
+	}
 
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Invalid or malformed token",
-			"error":   err.Error(),
-		})
-		c.Abort()
-		return nil, err
+	if revocations != nil {
+		revoked, err := isRevoked(claims)
+		if err != nil {
+			return nil, abort(c, http.StatusInternalServerError, "Could not check token revocation", err)
+		}
+		if revoked {
+			return nil, abort(c, http.StatusUnauthorized, "Access Token has been revoked", nil)
+		}
 	}
 
-	var ok bool
-	claims, ok = token.Claims.(jwt.MapClaims)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token claims"})
-		c.Abort()
+	if err = checkAccount(c, claims.UserId); err != nil {
 		return nil, err
 	}
 
-	exp, ok := claims["exp"].(float64)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid expiration in token"})
-		c.Abort()
-		return nil, err
+	c.Set("Mfa", claims.Mfa)
+	c.Set("TokenId", claims.ID)
+	c.Set("SessionId", claims.SessionId)
+	c.Set("TokenExpiresAt", claims.ExpiresAt.Time)
+
+	return claims, nil
+}
+
+// abort answers the request with an auth error and stops the handler chain. It
+// returns an error for the caller to pass on.
+func abort(c *gin.Context, status int, message string, err error) error {
+	body := gin.H{"message": message}
+	if err != nil {
+		body["error"] = err.Error()
 	}
+	c.AbortWithStatusJSON(status, body)
 
-	if float64(time.Now().Unix()) > exp {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Access Token has expired"})
-		c.Abort()
+	if err == nil {
+		err = errors.New(strings.ToLower(message))
+	}
+	return err
+}
+
+// apiKeyAuth authenticates a machine client. The claims are made up from the
+// key's user; keys are created by staff who passed two-factor authentication,
+// so they count as a second factor. Keys only open routes that require one of
+// their permissions, see authenticate.
+func apiKeyAuth(c *gin.Context, key string) (*helpers.TokenClaims, error) {
+	apiKey, user, err := apiKeys.AuthenticateAPIKey(key)
+	if err != nil {
+		return nil, abort(c, http.StatusUnauthorized, "Invalid, expired or revoked API key", nil)
+	}
+
+	if err = checkAccount(c, user.UserId.String()); err != nil {
 		return nil, err
 	}
 
-	return claims, nil
+	c.Set("Mfa", true)
+	c.Set("ApiKeyId", apiKey.KeyId)
+	c.Set("ApiKeyPermissions", apiKey.Permissions)
+
+	return &helpers.TokenClaims{
+		UserId: user.UserId.String(),
+		Email:  user.Email,
+		Role:   user.Role,
+		Mfa:    true,
+		Type:   helpers.TokenTypeAccess,
+	}, nil
 }
 
-func RequireAuth(c *gin.Context) {
-	claims, err := Auth(c)
+// checkAccount rejects requests of suspended or deleted accounts.
+func checkAccount(c *gin.Context, userId string) error {
+	if accounts == nil {
+		return nil
+	}
+
+	active, err := accounts.IsActive(userId)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Authorization Error",
-			"error":   err.Error(),
-		})
-		c.Abort()
-		return
+		return abort(c, http.StatusInternalServerError, "Could not check account status", err)
+	}
+	if !active {
+		return abort(c, http.StatusForbidden, "Account is suspended or deleted", nil)
 	}
 
-	email, emailOk := claims["Email"].(string)
-	userId, userIdOk := claims["UserId"].(string)
+	return nil
+}
 
-	if !emailOk || !userIdOk {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing or invalid token claims"})
-		c.Abort()
-		return
+// isRevoked reports whether the token was revoked by jti or session id, or
+// issued before the user's current token generation.
+func isRevoked(claims *helpers.TokenClaims) (bool, error) {
+	revoked, err := revocations.IsTokenRevoked(claims.ID)
+	if err != nil || revoked {
+		return revoked, err
 	}
 
-	c.Set("Email", email)
-	c.Set("UserId", userId)
+	if claims.SessionId != "" {
+		revoked, err = revocations.IsTokenRevoked(claims.SessionId)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
 
-	c.Next()
+	current, err := revocations.TokenGeneration(claims.UserId)
+	if err != nil {
+		return false, err
+	}
+
+	return claims.Generation < current, nil
 }
 
-func AdminAuth(c *gin.Context) {
+// authenticate runs Auth and puts the user of the token into the context. API
+// keys are refused unless the route requires a permission, which the key's
+// scopes then limit; self-service routes like data export or two-factor
+// enrollment are for the people behind the accounts only.
+func authenticate(c *gin.Context, apiKeyAllowed bool) (*helpers.TokenClaims, bool) {
 	claims, err := Auth(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"message": "Authorization Error",
-			"error":   err.Error(),
-		})
-		c.Abort()
-		return
+		return nil, false
 	}
 
-	role, ok := claims["Role"].(string)
-	fmt.Println(claims)
-	if !ok || role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Admin access required"})
-		c.Abort()
-		return
+	if !apiKeyAllowed && c.GetString("ApiKeyId") != "" {
+		abort(c, http.StatusForbidden, "API keys only open routes that require a permission", nil)
+		return nil, false
 	}
 
-	email, emailOk := claims["Email"].(string)
-	userId, userIdOk := claims["UserId"].(string)
+	c.Set("Email", claims.Email)
+	c.Set("UserId", claims.UserId)
+	c.Set("Role", claims.Role)
 
-	if !emailOk || !userIdOk {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing or invalid token claims"})
-		c.Abort()
+	return claims, true
+}
+
+// RequireAuth lets requests with a Bearer access token through. API keys are
+// refused.
+func RequireAuth(c *gin.Context) {
+	if _, ok := authenticate(c, false); !ok {
 		return
 	}
 
-	c.Set("Email", email)
-	c.Set("UserId", userId)
-
 	c.Next()
 }
+
+// RequirePermission only lets requests through whose role holds the permission.
+// Staff permissions also require a login that passed two-factor authentication.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := authenticate(c, true); !ok {
+			return
+		}
+
+		if denied := StaffAccessDenied(c, permission); denied != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": denied})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// StaffAccessDenied applies the rule of RequirePermission within a handler, for
+// staff actions that depend on the request. It returns why access is denied, or
+// "" if the role holds the permission and the login passed two-factor
+// authentication.
+func StaffAccessDenied(c *gin.Context, permission string) string {
+	if !HasPermission(c, permission) {
+		return "Missing permission " + permission
+	}
+
+	if !c.GetBool("Mfa") {
+		return "Staff access requires two-factor authentication, enroll at /protected/mfa/enroll and log in again"
+	}
+
+	return ""
+}
+
+// HasPermission reports whether the authenticated role of the request holds the
+// permission. Requests made with an API key only hold the key's permissions, as
+// far as the role of the key's user still holds them. Lookup errors count as not
+// granted.
+func HasPermission(c *gin.Context, permission string) bool {
+	if scopes, ok := c.Get("ApiKeyPermissions"); ok {
+		scoped := false
+		for _, scope := range scopes.([]string) {
+			if scope == permission || scope == models.PermAll {
+				scoped = true
+				break
+			}
+		}
+		if !scoped {
+			return false
+		}
+	}
+
+	if permissions == nil {
+		return false
+	}
+
+	granted, err := permissions.HasPermission(c.GetString("Role"), permission)
+	if err != nil {
+		log.Println("Failed to check permission:", err)
+		return false
+	}
+
+	return granted
+}
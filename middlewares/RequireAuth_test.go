@@ -0,0 +1,158 @@
+package middlewares
+
+import (
+	"errors"
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRequireAuthRejectsRevokedTokens(t *testing.T) {
+	testutil.Keyrings(t, helpers.UseKeyrings)
+
+	tests := []struct {
+		name    string
+		revoke  func(store *services.MemoryRevocationStore, tokenId string) // nil keeps the token valid
+		message string
+	}{
+		{name: "valid"},
+		{
+			name: "revoked jti",
+			revoke: func(store *services.MemoryRevocationStore, tokenId string) {
+				store.RevokeToken(tokenId, time.Now().Add(time.Hour))
+			},
+			message: "revoked",
+		},
+		{
+			name: "revoked sid",
+			revoke: func(store *services.MemoryRevocationStore, _ string) {
+				store.RevokeToken("session-1", time.Now().Add(time.Hour))
+			},
+			message: "revoked",
+		},
+		{
+			name: "old generation",
+			revoke: func(store *services.MemoryRevocationStore, _ string) {
+				store.RevokeUserTokens("user-1")
+			},
+			message: "revoked",
+		},
+		{
+			name: "other user's generation",
+			revoke: func(store *services.MemoryRevocationStore, _ string) {
+				store.RevokeUserTokens("user-2")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := services.NewMemoryRevocationStore()
+			UseRevocationStore(store)
+			t.Cleanup(func() { UseRevocationStore(nil) })
+
+			token, err := helpers.GenerateAccessToken("user-1", "user@example.com", "user", "session-1", 0, false)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+			claims, err := helpers.ParseAccessToken(token)
+			if err != nil {
+				t.Fatalf("failed to parse token: %v", err)
+			}
+			if tt.revoke != nil {
+				tt.revoke(store, claims.ID)
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/", RequireAuth, func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"userId": c.GetString("UserId")})
+			})
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+			router.ServeHTTP(recorder, request)
+
+			if tt.message == "" {
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("expected %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+				}
+				return
+			}
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("expected %d, got %d: %s", http.StatusUnauthorized, recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.message) {
+				t.Errorf("expected %q in %s", tt.message, recorder.Body)
+			}
+		})
+	}
+}
+
+// kioskKey authenticates the key "mrk_kiosk" as a user whose key is scoped to
+// reservations:read.
+type kioskKey struct{}
+
+func (kioskKey) AuthenticateAPIKey(key string) (*models.APIKey, *models.User, error) {
+	if key != "mrk_kiosk" {
+		return nil, nil, errors.New("invalid api key")
+	}
+	apiKey := &models.APIKey{KeyId: "key-1", Permissions: []string{models.PermReservationsRead}}
+	return apiKey, &models.User{UserId: uuid.New(), Email: "kiosk@example.com", Role: "admin"}, nil
+}
+
+// allPermissions grants every permission to every role.
+type allPermissions struct{}
+
+func (allPermissions) HasPermission(string, string) (bool, error) {
+	return true, nil
+}
+
+func TestAPIKeysOnlyOpenPermissionRoutes(t *testing.T) {
+	UseAPIKeys(kioskKey{})
+	UsePermissionChecker(allPermissions{})
+	t.Cleanup(func() {
+		UseAPIKeys(nil)
+		UsePermissionChecker(nil)
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/protected/me/export", RequireAuth, ok)
+	router.GET("/admin/all-reservations", RequirePermission(models.PermReservationsRead), ok)
+	router.GET("/admin/users", RequirePermission(models.PermUsersManage), ok)
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/protected/me/export", http.StatusForbidden},
+		{"/admin/all-reservations", http.StatusOK},
+		{"/admin/users", http.StatusForbidden}, // not in the key's scopes
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			request.Header.Set("Authorization", "ApiKey mrk_kiosk")
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
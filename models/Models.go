@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // === === === === ===
@@ -12,13 +13,33 @@ import (
 //
 // === === === === ===
 type User struct {
-	UserId    uuid.UUID `json:"userId" db:"userid"`
-	Name      string    `json:"name" db:"name"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"password" db:"password"`
-	Role      string    `json:"role" db:"role"`
-	CreatedAt time.Time `json:"createdAt" db:"createdat"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updatedat"`
+	UserId           uuid.UUID  `json:"userId" db:"userid"`
+	Name             string     `json:"name" db:"name"`
+	Email            string     `json:"email" db:"email"`
+	Password         string     `json:"password,omitempty" db:"password"`
+	Role             string     `json:"role" db:"role"`
+	Verified         bool       `json:"verified" db:"verified"`
+	DateOfBirth      *time.Time `json:"dateOfBirth,omitempty" db:"dateofbirth"`
+	SuspendedAt      *time.Time `json:"suspendedAt,omitempty" db:"suspendedat"`
+	SuspensionReason *string    `json:"suspensionReason,omitempty" db:"suspensionreason"`
+	DeletedAt        *time.Time `json:"deletedAt,omitempty" db:"deletedat"`
+	CreatedAt        time.Time  `json:"createdAt" db:"createdat"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updatedat"`
+}
+
+// UserPage is one page of an admin user listing.
+type UserPage struct {
+	Users []User `json:"users"`
+	Pagination
+}
+
+// Pagination describes a page of a listing and the size of the whole result.
+type Pagination struct {
+	Page     int `json:"page"`
+	PageSize int `json:"pageSize"`
+	Total    int `json:"total"`
+	// Next links the following page, empty on the last one.
+	Next string `json:"next,omitempty"`
 }
 
 type Credentials struct {
@@ -26,22 +47,211 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 
+// ProfileUpdate holds the profile fields a user can change directly. Email and
+// password have their own endpoints since they need the current password.
+type ProfileUpdate struct {
+	Name *string `json:"name"`
+	// DateOfBirth can only be set once, staff correct it afterwards.
+	DateOfBirth *time.Time `json:"dateOfBirth"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type EmailChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewEmail        string `json:"newEmail"`
+}
+
+// Session is one login of a user, i.e. one refresh token family. LastSeenAt
+// moves on with every token refresh.
+type Session struct {
+	SessionId  string     `json:"sessionId" db:"familyid"`
+	Device     string     `json:"device" db:"-"`
+	UserAgent  string     `json:"userAgent" db:"useragent"`
+	IPAddress  string     `json:"ipAddress" db:"ipaddress"`
+	Mfa        bool       `json:"mfa" db:"mfa"`
+	Current    bool       `json:"current" db:"-"`
+	CreatedAt  time.Time  `json:"createdAt" db:"createdat"`
+	LastSeenAt time.Time  `json:"lastSeenAt" db:"lastseenat"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revokedat"`
+}
+
+// Client is where a login or token refresh came from, recorded on the session.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// UserIdentity links an account to a user of a single sign-on provider.
+type UserIdentity struct {
+	Issuer      string     `json:"issuer" db:"issuer"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       string     `json:"email" db:"email"`
+	CreatedAt   time.Time  `json:"createdAt" db:"createdat"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty" db:"lastloginat"`
+}
+
 // === === === === ===
 //
 // === Movie Data ===
 //
 // === === === === ===
 type Movie struct {
-	MovieId     string    `json:"MovieId" db:"movieid"`
+	MovieId      string    `json:"MovieId" db:"movieid"`
+	Title        string    `json:"title" db:"title"`
+	Description  string    `json:"description" db:"description"`
+	Duration     int       `json:"duration" db:"duration"`
+	Director     string    `json:"director" db:"director"`
+	PosterImage  string    `json:"posterImage" db:"posterimage"`
+	ReleaseDate  time.Time `json:"releaseDate" db:"releasedate"`
+	RatingSystem *string   `json:"ratingSystem,omitempty" db:"ratingsystem"` // e.g. "MPAA"
+	Rating       *string   `json:"rating,omitempty" db:"rating"`             // e.g. "R"
+	CreatedAt    time.Time `json:"createdAt" db:"createdat"`
+	UpdatedAt    time.Time `json:"updatedAt" db:"updatedat"`
+
+	Genres []Genre `json:"genres" db:"-"`
+	// GenreIds sets the genres when adding or updating a movie.
+	GenreIds []string `json:"genreIds,omitempty" db:"-"`
+	// ClearRating makes an update reset the movie to unrated.
+	ClearRating bool `json:"clearRating,omitempty" db:"-"`
+	// Credits are only filled in for a single movie.
+	Credits *MovieCredits `json:"credits,omitempty" db:"-"`
+}
+
+// ContentRating is a rating of an age rating system like MPAA or BBFC. Booking
+// a movie rated with a minimum age requires a customer at least that old.
+type ContentRating struct {
+	RatingSystem string `json:"ratingSystem" db:"ratingsystem"`
+	Rating       string `json:"rating" db:"rating"`
+	MinimumAge   int    `json:"minimumAge" db:"minimumage"`
+	Description  string `json:"description" db:"description"`
+}
+
+// Genre classifies movies. The slug is the normalized name; names whose slugs
+// collide are the same genre.
+type Genre struct {
+	GenreId   string    `json:"genreId" db:"genreid"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	CreatedAt time.Time `json:"createdAt" db:"createdat"`
+}
+
+// Movie catalogue statuses to filter by.
+const (
+	MovieNowShowing = "now_showing" // has showtimes still to come
+	MovieComingSoon = "coming_soon" // not released yet
+)
+
+// MovieFilter narrows and orders the movie catalogue. Zero values filter nothing.
+type MovieFilter struct {
+	// Genre is a genre name, slug or the name of a genre merged into another.
+	Genre        string
+	Director     string
+	ReleasedFrom *time.Time
+	ReleasedTo   *time.Time
+	MinDuration  int
+	MaxDuration  int
+	Status       string
+	// Sort is a sort key like "title" or "-releaseDate" for descending order.
+	Sort string
+}
+
+// MovieSearchHit is a movie found by a full-text search. The highlights are
+// the matching parts of its fields with the search terms wrapped in <b> tags.
+type MovieSearchHit struct {
+	Movie      Movie           `json:"movie"`
+	Rank       float64         `json:"rank"`
+	Highlights MovieHighlights `json:"highlights"`
+}
+
+type MovieHighlights struct {
+	Title       string `json:"title"`
+	Director    string `json:"director"`
+	Description string `json:"description"`
+}
+
+// MovieSearchPage is one page of movie search results, best matches first.
+type MovieSearchPage struct {
+	Query string           `json:"query"`
+	Hits  []MovieSearchHit `json:"hits"`
+	Pagination
+}
+
+// MoviePage is one page of the movie catalogue.
+type MoviePage struct {
+	Movies []*Movie `json:"movies"`
+	Pagination
+}
+
+// === === === === ===
+//
+// === People Data ===
+//
+// === === === === ===
+
+// Roles a person can be credited with on a movie.
+const (
+	CreditActor    = "actor"
+	CreditDirector = "director"
+	CreditWriter   = "writer"
+	CreditComposer = "composer"
+)
+
+type Person struct {
+	PersonId   string     `json:"personId" db:"personid"`
+	Name       string     `json:"name" db:"name"`
+	BirthDate  *time.Time `json:"birthDate,omitempty" db:"birthdate"`
+	Biography  string     `json:"biography" db:"biography"`
+	PhotoImage string     `json:"photoImage" db:"photoimage"`
+	CreatedAt  time.Time  `json:"createdAt" db:"createdat"`
+	UpdatedAt  time.Time  `json:"updatedAt" db:"updatedat"`
+}
+
+// PeoplePage is one page of a people listing.
+type PeoplePage struct {
+	People []Person `json:"people"`
+	Pagination
+}
+
+// Credit is the part a person had in a movie. Character is only set for actors,
+// billing orders the credits of a role, lower first.
+type Credit struct {
+	CreditId     string `json:"creditId" db:"creditid"`
+	MovieId      string `json:"movieId" db:"movieid"`
+	PersonId     string `json:"personId" db:"personid"`
+	Role         string `json:"role" db:"role"`
+	Character    string `json:"character,omitempty" db:"charactername"`
+	BillingOrder int    `json:"billingOrder" db:"billingorder"`
+
+	// of the person, in the credits of a movie
+	Name       string `json:"name,omitempty" db:"name"`
+	PhotoImage string `json:"photoImage,omitempty" db:"photoimage"`
+}
+
+// MovieCredits are the credits of a movie split into actors and everyone else.
+type MovieCredits struct {
+	Cast []Credit `json:"cast"`
+	Crew []Credit `json:"crew"`
+}
+
+// FilmographyEntry is a credit of a person along with the movie it is for.
+type FilmographyEntry struct {
+	CreditId    string    `json:"creditId" db:"creditid"`
+	Role        string    `json:"role" db:"role"`
+	Character   string    `json:"character,omitempty" db:"charactername"`
+	MovieId     string    `json:"movieId" db:"movieid"`
 	Title       string    `json:"title" db:"title"`
-	Description string    `json:"description" db:"description"`
-	Genre       string    `json:"genre" db:"genre"`
-	Duration    int       `json:"duration" db:"duration"`
-	Director    string    `json:"director" db:"director"`
 	PosterImage string    `json:"posterImage" db:"posterimage"`
 	ReleaseDate time.Time `json:"releaseDate" db:"releasedate"`
-	CreatedAt   time.Time `json:"createdAt" db:"createdat"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updatedat"`
+}
+
+// Filmography is a person with all their credits, newest movies first.
+type Filmography struct {
+	Person  Person             `json:"person"`
+	Credits []FilmographyEntry `json:"credits"`
 }
 
 // === === === === ===
@@ -55,6 +265,7 @@ type Showtime struct {
 	StartTime      time.Time `json:"startTime" db:"starttime"`
 	EndTime        time.Time `json:"endTime" db:"endtime"`
 	Venue          string    `json:"venue" db:"venue"`
+	AuditoriumId   *string   `json:"auditoriumId" db:"auditoriumid"`
 	PricePerSeat   float64   `json:"pricePerSeat" db:"priceperseat"`
 	AvailableSeats int       `json:"availableSeats" db:"availableseats"`
 	CreatedAt      time.Time `json:"createdAt" db:"createdat"`
@@ -69,16 +280,81 @@ type ShowtimeAndMovie struct {
 	PricePerSeat   float64   `db:"priceperseat" json:"pricePerSeat"`
 	AvailableSeats int       `db:"availableseats" json:"availableSeats"`
 
-	MovieId     string `db:"movieid" json:"movieId"`
-	Title       string `db:"title" json:"title"`
-	Genre       string `db:"genre" json:"genre"`
-	Director    string `db:"director" json:"director"`
-	PosterImage string `db:"posterimage" json:"posterImage"`
+	MovieId     string         `db:"movieid" json:"movieId"`
+	Title       string         `db:"title" json:"title"`
+	Genres      pq.StringArray `db:"genres" json:"genres"`
+	Director    string         `db:"director" json:"director"`
+	PosterImage string         `db:"posterimage" json:"posterImage"`
+}
+
+// === === === === ===
+//
+// === Auditorium Data ===
+//
+// === === === === ===
+type Auditorium struct {
+	AuditoriumId string    `json:"auditoriumId" db:"auditoriumid"`
+	Name         string    `json:"name" db:"name"`
+	Venue        string    `json:"venue" db:"venue"`
+	CreatedAt    time.Time `json:"createdAt" db:"createdat"`
+	UpdatedAt    time.Time `json:"updatedAt" db:"updatedat"`
+	Seats        []Seat    `json:"seats,omitempty" db:"-"`
+}
+
+// Seat types supported in an auditorium layout.
+const (
+	SeatTypeStandard   = "standard"
+	SeatTypePremium    = "premium"
+	SeatTypeWheelchair = "wheelchair"
+)
+
+type Seat struct {
+	SeatId       string `json:"seatId" db:"seatid"`
+	AuditoriumId string `json:"auditoriumId" db:"auditoriumid"`
+	RowLabel     string `json:"rowLabel" db:"rowlabel"`
+	RowIndex     int    `json:"rowIndex" db:"rowindex"`
+	SeatNumber   int    `json:"seatNumber" db:"seatnumber"`
+	SeatType     string `json:"seatType" db:"seattype"`
+	AisleLeft    bool   `json:"aisleLeft" db:"aisleleft"`
+	AisleRight   bool   `json:"aisleRight" db:"aisleright"`
+	Disabled     bool   `json:"disabled" db:"disabled"`
+}
+
+// RowLayout describes one row of an auditorium when it is created.
+// Seats are numbered 1..Seats from left to right.
+type RowLayout struct {
+	Label         string         `json:"label"`
+	Seats         int            `json:"seats"`
+	SeatType      string         `json:"seatType"`
+	SeatTypes     map[int]string `json:"seatTypes"`     // per-seat overrides of SeatType
+	AislesAfter   []int          `json:"aislesAfter"`   // an aisle follows these seat numbers
+	DisabledSeats []int          `json:"disabledSeats"` // seats that cannot be sold
 }
 
-type SeatsAndPrice struct {
-	PricePerSeat   float64 `db:"priceperseat" json:"pricePerSeat"`
-	AvailableSeats int     `db:"availableseats" json:"availableSeats"`
+type AuditoriumLayout struct {
+	Name  string      `json:"name"`
+	Venue string      `json:"venue"`
+	Rows  []RowLayout `json:"rows"`
+}
+
+// ShowtimeSeat is a seat of a showtime's auditorium together with its booking state.
+type ShowtimeSeat struct {
+	Seat
+	Taken bool `json:"taken" db:"taken"`
+}
+
+type SeatRow struct {
+	RowLabel string         `json:"rowLabel"`
+	Seats    []ShowtimeSeat `json:"seats"`
+}
+
+type SeatMap struct {
+	ShowtimeId     string    `json:"showtimeId"`
+	AuditoriumId   string    `json:"auditoriumId"`
+	AuditoriumName string    `json:"auditoriumName"`
+	PricePerSeat   float64   `json:"pricePerSeat"`
+	AvailableSeats int       `json:"availableSeats"`
+	Rows           []SeatRow `json:"rows"`
 }
 
 // === === === === ===
@@ -86,17 +362,154 @@ type SeatsAndPrice struct {
 // === Reservation Data ===
 //
 // === === === === ===
+// Reservation states. Cancelled reservations are kept as records.
+const (
+	ReservationConfirmed = "confirmed"
+	ReservationCancelled = "cancelled"
+)
+
 type Reservation struct {
-	ReservationId   string    `json:"reservationId" db:"reservationid"`
-	UserId          uuid.UUID `json:"userId" db:"userid"`
-	ShowtimeId      string    `json:"showtimeId" db:"showtimeid"`
-	NumberOfSeats   int       `json:"numberOfSeats" db:"numberofseats"`
-	TotalPrice      float64   `json:"totalPrice" db:"totalprice"`
-	ReservationDate time.Time `json:"reservationDate" db:"reservationdate"`
+	ReservationId   string     `json:"reservationId" db:"reservationid"`
+	UserId          uuid.UUID  `json:"userId" db:"userid"`
+	ShowtimeId      string     `json:"showtimeId" db:"showtimeid"`
+	NumberOfSeats   int        `json:"numberOfSeats" db:"numberofseats"`
+	TotalPrice      float64    `json:"totalPrice" db:"totalprice"`
+	ReservationDate time.Time  `json:"reservationDate" db:"reservationdate"`
+	Status          string     `json:"status" db:"status"`
+	CancelledAt     *time.Time `json:"cancelledAt" db:"cancelledat"`
+	IdCheckRequired bool       `json:"idCheckRequired" db:"idcheckrequired"` // age-restricted, door staff check ID
+	Seats           []Seat     `json:"seats,omitempty" db:"-"`
 }
 
 type BookingData struct {
 	ShowtimeId string    `json:"showtimeId"`
 	UserId     uuid.UUID `json:"userId"`
 	Seats      int       `json:"seats"`
+	SeatIds    []string  `json:"seatIds"`
+}
+
+// === === === === ===
+//
+// === Seat Hold Data ===
+//
+// === === === === ===
+
+// Seat hold states. Only active holds keep seats away from other customers.
+const (
+	HoldStatusActive    = "active"
+	HoldStatusReleased  = "released"
+	HoldStatusExpired   = "expired"
+	HoldStatusConverted = "converted"
+)
+
+type SeatHold struct {
+	HoldId        string    `json:"holdId" db:"holdid"`
+	UserId        uuid.UUID `json:"userId" db:"userid"`
+	ShowtimeId    string    `json:"showtimeId" db:"showtimeid"`
+	NumberOfSeats int       `json:"numberOfSeats" db:"numberofseats"`
+	Status        string    `json:"status" db:"status"`
+	ExpiresAt     time.Time `json:"expiresAt" db:"expiresat"`
+	CreatedAt     time.Time `json:"createdAt" db:"createdat"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updatedat"`
+	Seats         []Seat    `json:"seats,omitempty" db:"-"`
+}
+
+type HoldRequest struct {
+	ShowtimeId string   `json:"showtimeId"`
+	Seats      int      `json:"seats"`
+	SeatIds    []string `json:"seatIds"`
+}
+
+// === === === === ===
+//
+// === Two-Factor Data ===
+//
+// === === === === ===
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauthUrl"`
+}
+
+// === === === === ===
+//
+// === Role Data ===
+//
+// === === === === ===
+
+// Permissions checked per route. Roles are granted permissions in role_permissions;
+// PermAll grants every permission.
+const (
+	PermAll                       = "*"
+	PermUsersManage               = "users:manage"
+	PermRolesManage               = "roles:manage"
+	PermMoviesManage              = "movies:manage"
+	PermReservationsRead          = "reservations:read"
+	PermReservationsBookForOthers = "reservations:book_for_others"
+	PermAPIKeysManage             = "api_keys:manage"
+)
+
+// IsPermission reports whether permission is one of the Perm constants.
+func IsPermission(permission string) bool {
+	switch permission {
+	case PermAll, PermUsersManage, PermRolesManage, PermMoviesManage, PermReservationsRead,
+		PermReservationsBookForOthers, PermAPIKeysManage:
+		return true
+	}
+	return false
+}
+
+// RoleUser is the default role of every customer account.
+const RoleUser = "user"
+
+type Role struct {
+	Name        string   `json:"name" db:"name"`
+	Description string   `json:"description" db:"description"`
+	Permissions []string `json:"permissions" db:"-"`
+}
+
+// === === === === ===
+//
+// === API Key Data ===
+//
+// === === === === ===
+
+// APIKey is a long-lived credential of a machine client. It acts as its user but
+// only holds its own permissions, not the ones of the user's role.
+type APIKey struct {
+	KeyId       string     `json:"keyId" db:"keyid"`
+	Name        string     `json:"name" db:"name"`
+	KeyPrefix   string     `json:"keyPrefix" db:"keyprefix"`
+	UserId      uuid.UUID  `json:"userId" db:"userid"`
+	Permissions []string   `json:"permissions" db:"-"`
+	CreatedBy   *uuid.UUID `json:"createdBy,omitempty" db:"createdby"`
+	ExpiresAt   time.Time  `json:"expiresAt" db:"expiresat"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty" db:"lastusedat"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty" db:"revokedat"`
+	CreatedAt   time.Time  `json:"createdAt" db:"createdat"`
+}
+
+type APIKeyRequest struct {
+	Name        string     `json:"name"`
+	UserId      uuid.UUID  `json:"userId"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// === === === === ===
+//
+// === Personal Data ===
+//
+// === === === === ===
+
+// PersonalDataExport is everything stored about a user, as handed out on a
+// data subject access request.
+type PersonalDataExport struct {
+	ExportedAt       time.Time      `json:"exportedAt"`
+	Profile          User           `json:"profile"`
+	TwoFactorEnabled bool           `json:"twoFactorEnabled"`
+	Reservations     []Reservation  `json:"reservations"`
+	SeatHolds        []SeatHold     `json:"seatHolds"`
+	Sessions         []Session      `json:"sessions"`
+	Identities       []UserIdentity `json:"identities"`
+	APIKeys          []APIKey       `json:"apiKeys"`
 }
@@ -0,0 +1,246 @@
+package oidc_test
+
+import (
+	"movie/internal/testutil"
+	"movie/oidc"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLoginFlow(t *testing.T) {
+	mock, provider := testutil.OIDCProvider(t)
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatalf("failed to create pkce: %v", err)
+	}
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("failed to build auth url: %v", err)
+	}
+
+	code, state, err := mock.Authorize(authURL, jwt.MapClaims{
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"groups":         []string{"box-office", "staff"},
+		"amr":            []string{"pwd", "mfa"},
+	})
+	if err != nil {
+		t.Fatalf("provider refused the auth request: %v", err)
+	}
+	if state != "state-1" {
+		t.Errorf("expected state-1 back, got %q", state)
+	}
+
+	claims, err := provider.Exchange(code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if !slices.Equal(claims.Groups, []string{"box-office", "staff"}) {
+		t.Errorf("unexpected groups %v", claims.Groups)
+	}
+	if !slices.Contains(claims.AMR, "mfa") {
+		t.Errorf("unexpected amr %v", claims.AMR)
+	}
+
+	if _, err = provider.Exchange(code, verifier, "nonce-1"); err == nil {
+		t.Error("expected a used code to be rejected")
+	}
+}
+
+func TestExchangeRequiresPKCEVerifierAndNonce(t *testing.T) {
+	mock, provider := testutil.OIDCProvider(t)
+
+	tests := []struct {
+		name     string
+		verifier func(verifier string) string
+		nonce    string
+		error    string
+	}{
+		{"wrong verifier", func(string) string { return "guessed-verifier" }, "nonce-1", "code_verifier"},
+		{"missing verifier", func(string) string { return "" }, "nonce-1", "code_verifier"},
+		{"wrong nonce", func(verifier string) string { return verifier }, "nonce-2", "nonce mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, challenge, err := oidc.NewPKCE()
+			if err != nil {
+				t.Fatalf("failed to create pkce: %v", err)
+			}
+			authURL, err := provider.AuthCodeURL("state-1", "nonce-1", challenge)
+			if err != nil {
+				t.Fatalf("failed to build auth url: %v", err)
+			}
+			code, _, err := mock.Authorize(authURL, nil)
+			if err != nil {
+				t.Fatalf("provider refused the auth request: %v", err)
+			}
+
+			_, err = provider.Exchange(code, tt.verifier(verifier), tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Fatalf("expected an error about %s, got %v", tt.error, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := testutil.OIDCProvider(t)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   mock.URL,
+			"aud":   mock.ClientID,
+			"sub":   "subject-1",
+			"nonce": "nonce-1",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	signed := func(modify func(jwt.MapClaims)) func(t *testing.T) string {
+		return func(t *testing.T) string {
+			claims := valid()
+			modify(claims)
+			token, err := mock.Sign(claims)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+			return token
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		error string // "" for valid tokens
+	}{
+		{name: "valid", token: signed(func(jwt.MapClaims) {})},
+		{name: "one of several audiences", token: signed(func(claims jwt.MapClaims) {
+			claims["aud"] = []string{"other-client", mock.ClientID}
+			claims["azp"] = mock.ClientID
+		})},
+		{
+			name:  "wrong audience",
+			token: signed(func(claims jwt.MapClaims) { claims["aud"] = "other-client" }),
+			error: "audience",
+		},
+		{
+			name: "authorized party is another client",
+			token: signed(func(claims jwt.MapClaims) {
+				claims["aud"] = []string{"other-client", mock.ClientID}
+				claims["azp"] = "other-client"
+			}),
+			error: "issued to other-client",
+		},
+		{
+			name:  "wrong issuer",
+			token: signed(func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }),
+			error: "issuer",
+		},
+		{
+			name:  "expired",
+			token: signed(func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }),
+			error: "expired",
+		},
+		{
+			name:  "missing exp",
+			token: signed(func(claims jwt.MapClaims) { delete(claims, "exp") }),
+			error: "exp",
+		},
+		{
+			name:  "missing subject",
+			token: signed(func(claims jwt.MapClaims) { delete(claims, "sub") }),
+			error: "no subject",
+		},
+		{
+			name:  "missing nonce",
+			token: signed(func(claims jwt.MapClaims) { delete(claims, "nonce") }),
+			error: "nonce mismatch",
+		},
+		{
+			name: "signed with the client secret",
+			token: func(t *testing.T) string {
+				token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("client-secret"))
+				if err != nil {
+					t.Fatalf("failed to sign token: %v", err)
+				}
+				return token
+			},
+			error: "signing method",
+		},
+		{
+			name:  "malformed",
+			token: func(*testing.T) string { return "not.a.token" },
+			error: "malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(tt.token(t), "nonce-1")
+			if tt.error == "" {
+				if err != nil {
+					t.Fatalf("expected a valid token, got %v", err)
+				}
+				if claims.Subject != "subject-1" {
+					t.Errorf("unexpected subject %q", claims.Subject)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Fatalf("expected an error about %s, got %v", tt.error, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenReadsGroupsClaim(t *testing.T) {
+	mock, provider := testutil.OIDCProvider(t)
+	provider.GroupsClaim = "roles"
+
+	tests := []struct {
+		name   string
+		groups interface{}
+		want   []string
+	}{
+		{"list", []string{"movie-admins", "staff"}, []string{"movie-admins", "staff"}},
+		{"space separated", "movie-admins staff", []string{"movie-admins", "staff"}},
+		{"missing", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss":    mock.URL,
+				"aud":    mock.ClientID,
+				"sub":    "subject-1",
+				"exp":    time.Now().Add(time.Hour).Unix(),
+				"groups": []string{"ignored"},
+			}
+			if tt.groups != nil {
+				claims["roles"] = tt.groups
+			}
+			token, err := mock.Sign(claims)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+
+			idClaims, err := provider.VerifyIDToken(token, "")
+			if err != nil {
+				t.Fatalf("expected a valid token, got %v", err)
+			}
+			if !slices.Equal(idClaims.Groups, tt.want) {
+				t.Errorf("expected groups %v, got %v", tt.want, idClaims.Groups)
+			}
+		})
+	}
+}
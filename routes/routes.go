@@ -1,59 +1,196 @@
 package routes
 
 import (
+	"log"
 	controllers "movie/controller"
+	"movie/helpers"
+	"movie/keyring"
+	"movie/mailer"
 	"movie/middlewares"
+	"movie/models"
+	"movie/oidc"
 	"movie/services"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 func SetupRouter(router *gin.Engine, db *sqlx.DB) {
+	// Token signing keys
+	accessKeys, err := keyring.FromEnv("ACCESS")
+	if err != nil {
+		log.Fatal("Failed to load access token keys: ", err)
+	}
+	refreshKeys, err := keyring.FromEnv("REFRESH")
+	if err != nil {
+		log.Fatal("Failed to load refresh token keys: ", err)
+	}
+	helpers.UseKeyrings(accessKeys, refreshKeys)
+
+	// Single sign-on, optional
+	ssoProvider, err := oidc.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure single sign-on: ", err)
+	}
+
+	// Outgoing email
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure mail: ", err)
+	}
+
+	// Token revocation, kept in the database unless configured otherwise
+	var revocationStore services.RevocationStore = services.NewDBRevocationStore(db)
+	if os.Getenv("REVOCATION_STORE") == "memory" {
+		revocationStore = services.NewMemoryRevocationStore()
+	}
+	middlewares.UseRevocationStore(revocationStore)
+
+	permissionService := services.NewPermissionService(db)
+	middlewares.UsePermissionChecker(permissionService)
+
 	// Services
-	userService := services.NewuserService(db)
+	tokenService := services.NewTokenService(db, revocationStore)
+	loginAttemptService := services.NewLoginAttemptService(db)
+	mfaService := services.NewMFAService(db, tokenService, loginAttemptService)
+	userService := services.NewuserService(db, tokenService, mfaService, loginAttemptService, mail)
+	middlewares.UseAccountChecker(userService)
 	movieService := services.NewMovieService(db)
+	genreService := services.NewGenreService(db)
+	personService := services.NewPersonService(db)
 	showtimeService := services.NewShowtimeService(db)
 	reservationService := services.NewReservationService(db)
+	auditoriumService := services.NewAuditoriumService(db)
+	holdService := services.NewHoldService(db)
+	privacyService := services.NewPrivacyService(db, tokenService)
+	apiKeyService := services.NewAPIKeyService(db, permissionService)
+	ssoService := services.NewSSOService(db, ssoProvider, tokenService, mfaService)
+	middlewares.UseAPIKeys(apiKeyService)
+
+	// Background jobs
+	holdService.StartReaper(time.Minute)
 
 	// Controllers
 	userController := controllers.NewUserController(userService)
 	movieController := controllers.NewMovieController(movieService)
+	genreController := controllers.NewGenreController(genreService)
+	personController := controllers.NewPersonController(personService)
 	showtimeContoller := controllers.NewShowtimeController(showtimeService)
 	reservationController := controllers.NewReservationServiceController(reservationService)
+	auditoriumController := controllers.NewAuditoriumController(auditoriumService)
+	holdController := controllers.NewHoldController(holdService)
+	mfaController := controllers.NewMFAController(mfaService)
+	roleController := controllers.NewRoleController(permissionService)
+	privacyController := controllers.NewPrivacyController(privacyService)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService)
+	jwksController := controllers.NewJWKSController(accessKeys)
+	ssoController := controllers.NewSSOController(ssoService)
+	sessionController := controllers.NewSessionController(tokenService)
+
+	// Public keys of access tokens
+	router.GET("/.well-known/jwks.json", jwksController.GetJWKS)
 
 	// Authentication Routes
 	accountRoutes := router.Group("/account")
 	{
 		accountRoutes.POST("/login", userController.Login)
 		accountRoutes.POST("/signup", userController.Signup)
+		accountRoutes.POST("/mfa/verify", mfaController.VerifyLogin)
+		accountRoutes.GET("/sso/login", ssoController.Login)
+		accountRoutes.GET("/sso/callback", ssoController.Callback)
+		accountRoutes.POST("/refresh", userController.Refresh)
+		accountRoutes.POST("/verify-email", userController.VerifyEmail)
+		accountRoutes.POST("/resend-verification", userController.ResendVerification)
+		accountRoutes.POST("/request-password-reset", userController.RequestPasswordReset)
+		accountRoutes.POST("/reset-password", userController.ResetPassword)
+		accountRoutes.POST("/logout", middlewares.RequireAuth, userController.Logout)
+		accountRoutes.POST("/logout-all", middlewares.RequireAuth, userController.LogoutAll)
 	}
 
 	// Protected Routes
 	protected := router.Group("/protected")
 	protected.Use(middlewares.RequireAuth)
 	{
+		protected.GET("/me", userController.GetProfile)
+		protected.PATCH("/me", userController.UpdateProfile)
+		protected.POST("/me/change-password", userController.ChangePassword)
+		protected.POST("/me/change-email", userController.ChangeEmail)
+		protected.GET("/me/export", privacyController.ExportOwnData)
+		protected.POST("/me/erase", privacyController.EraseOwnAccount)
+		protected.GET("/sessions", sessionController.GetSessions)
+		protected.POST("/sessions/revoke", sessionController.RevokeSession)
 		protected.GET("/movies", movieController.GetMovies)
+		protected.GET("/movies/search", movieController.SearchMovies)
+		protected.GET("/genres", genreController.GetGenres)
+		protected.GET("/content-ratings", movieController.GetContentRatings)
+		protected.GET("/people", personController.GetPeople)
+		protected.GET("/filmography", personController.GetFilmography)
 		protected.POST("/get-movie-byid", movieController.GetMovieById)
 		protected.POST("/get-showtime-and-movie", showtimeContoller.GetShowtimeAndMovie)
 		protected.POST("/get-seatsinfo", showtimeContoller.CheckAvailableSeats)
 		protected.POST("/upcoming-reservations", reservationController.GetUpcomingReservations)
 		protected.POST("/cancel-reservation", reservationController.CancelReservation)
 		protected.POST("/book-seats", reservationController.BookSeats)
+		protected.POST("/hold-seats", holdController.CreateHold)
+		protected.POST("/get-hold", holdController.GetHold)
+		protected.POST("/extend-hold", holdController.ExtendHold)
+		protected.POST("/release-hold", holdController.ReleaseHold)
+		protected.POST("/convert-hold", holdController.ConvertHold)
+		protected.POST("/mfa/enroll", mfaController.Enroll)
+		protected.POST("/mfa/confirm", mfaController.Confirm)
+		protected.POST("/mfa/disable", mfaController.Disable)
+		protected.POST("/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
 	}
 
-	// Admin Routes
+	// Admin Routes, every route requires its own permission
 	admin := router.Group("/admin")
-	admin.Use(middlewares.AdminAuth)
 	{
-		admin.POST("/promote", userController.PromoteToAdmin)
-		admin.POST("/add-movie", movieController.AddMovie)
-		admin.POST("/delete-movie", movieController.DeleteMovie)
-		admin.PATCH("/update-movie", movieController.UpdateMovies)
-		admin.POST("/add-showtime", showtimeContoller.AddShowtimes)
-		admin.POST("/delete-showtime", showtimeContoller.DeleteShowtime)
-		admin.PATCH("/update-showtime", showtimeContoller.UpdateShowtime)
-		admin.GET("/all-reservations", reservationController.GetAllReservations)
-		admin.POST("/user-reservations", reservationController.GetUserReservations)
+		usersManage := middlewares.RequirePermission(models.PermUsersManage)
+		rolesManage := middlewares.RequirePermission(models.PermRolesManage)
+		moviesManage := middlewares.RequirePermission(models.PermMoviesManage)
+		reservationsRead := middlewares.RequirePermission(models.PermReservationsRead)
+		apiKeysManage := middlewares.RequirePermission(models.PermAPIKeysManage)
+
+		admin.GET("/users", usersManage, userController.GetUsers)
+		admin.POST("/promote", rolesManage, userController.PromoteToAdmin)
+		admin.POST("/demote", rolesManage, userController.Demote)
+		admin.POST("/suspend", usersManage, userController.Suspend)
+		admin.POST("/unsuspend", usersManage, userController.Unsuspend)
+		admin.POST("/set-date-of-birth", usersManage, userController.SetDateOfBirth)
+		admin.POST("/delete-user", usersManage, userController.DeleteUser)
+		admin.GET("/export-user-data", usersManage, privacyController.ExportUserData)
+		admin.POST("/erase-user", usersManage, privacyController.EraseUser)
+		admin.POST("/verify-user", usersManage, userController.MarkVerified)
+		admin.POST("/unlock-account", usersManage, userController.UnlockAccount)
+		admin.POST("/assign-role", rolesManage, userController.AssignRole)
+		admin.GET("/roles", rolesManage, roleController.GetRoles)
+		admin.POST("/set-role-permissions", rolesManage, roleController.SetRolePermissions)
+		admin.POST("/api-keys", apiKeysManage, apiKeyController.CreateAPIKey)
+		admin.GET("/api-keys", apiKeysManage, apiKeyController.GetAPIKeys)
+		admin.POST("/revoke-api-key", apiKeysManage, apiKeyController.RevokeAPIKey)
+		admin.POST("/add-movie", moviesManage, movieController.AddMovie)
+		admin.POST("/delete-movie", moviesManage, movieController.DeleteMovie)
+		admin.PATCH("/update-movie", moviesManage, movieController.UpdateMovies)
+		admin.POST("/set-content-rating", moviesManage, movieController.SetContentRating)
+		admin.POST("/add-genre", moviesManage, genreController.AddGenre)
+		admin.PATCH("/update-genre", moviesManage, genreController.RenameGenre)
+		admin.POST("/delete-genre", moviesManage, genreController.DeleteGenre)
+		admin.POST("/merge-genres", moviesManage, genreController.MergeGenres)
+		admin.POST("/add-person", moviesManage, personController.AddPerson)
+		admin.PATCH("/update-person", moviesManage, personController.UpdatePerson)
+		admin.POST("/delete-person", moviesManage, personController.DeletePerson)
+		admin.POST("/add-credit", moviesManage, personController.AddCredit)
+		admin.POST("/delete-credit", moviesManage, personController.DeleteCredit)
+		admin.POST("/add-showtime", moviesManage, showtimeContoller.AddShowtimes)
+		admin.POST("/delete-showtime", moviesManage, showtimeContoller.DeleteShowtime)
+		admin.PATCH("/update-showtime", moviesManage, showtimeContoller.UpdateShowtime)
+		admin.POST("/add-auditorium", moviesManage, auditoriumController.AddAuditorium)
+		admin.GET("/auditoriums", moviesManage, auditoriumController.GetAuditoriums)
+		admin.POST("/get-auditorium-byid", moviesManage, auditoriumController.GetAuditoriumById)
+		admin.POST("/delete-auditorium", moviesManage, auditoriumController.DeleteAuditorium)
+		admin.GET("/all-reservations", reservationsRead, reservationController.GetAllReservations)
+		admin.POST("/user-reservations", reservationsRead, reservationController.GetUserReservations)
 	}
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	apiKeyDefaultTTL = 365 * 24 * time.Hour
+	// lastusedat is written at most this often per key
+	apiKeyUsageInterval = time.Minute
+)
+
+// APIKeyService manages API keys of machine clients like lobby kiosks. Only the
+// sha256 of a key is stored; the key itself is shown once, when it is created.
+type APIKeyService struct {
+	DB          *sqlx.DB
+	Permissions *PermissionService
+}
+
+func NewAPIKeyService(db *sqlx.DB, permissions *PermissionService) *APIKeyService {
+	return &APIKeyService{
+		DB:          db,
+		Permissions: permissions,
+	}
+}
+
+// CreateAPIKey stores a new key for the requested user and returns it together
+// with the key in clear text. A key can only be scoped to permissions that both
+// its creator (creatorHolds) and the role of its user hold. Keys acting as
+// someone else, e.g. a kiosk's service account, also need users:manage.
+func (as *APIKeyService) CreateAPIKey(req *models.APIKeyRequest, createdBy uuid.UUID, creatorHolds func(permission string) bool) (*models.APIKey, string, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if req.UserId == uuid.Nil {
+		return nil, "", fmt.Errorf("userId is required")
+	}
+	if req.UserId != createdBy && !creatorHolds(models.PermUsersManage) {
+		return nil, "", fmt.Errorf("can't create keys for other users without permission %s, which you don't hold", models.PermUsersManage)
+	}
+	for _, permission := range req.Permissions {
+		if !models.IsPermission(permission) {
+			return nil, "", fmt.Errorf("permissions must be known permissions, %q is not", permission)
+		}
+		if !creatorHolds(permission) {
+			return nil, "", fmt.Errorf("can't grant permission %s you don't hold", permission)
+		}
+	}
+
+	expiresAt := time.Now().Add(apiKeyDefaultTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, "", fmt.Errorf("expiresAt must be in the future")
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	var role string
+	userQuery := `SELECT role FROM users WHERE userid = $1 AND suspendedat IS NULL AND deletedat IS NULL`
+	err := as.DB.Get(&role, userQuery, req.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("user not found or not active")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error checking user: %w", err)
+	}
+
+	// The key acts as its user, so it can't do more than the user's role
+	for _, permission := range req.Permissions {
+		granted, err := as.Permissions.HasPermission(role, permission)
+		if err != nil {
+			return nil, "", err
+		}
+		if !granted {
+			return nil, "", fmt.Errorf("permission %s is not held by the user's role %s", permission, role)
+		}
+	}
+
+	key, prefix, keyHash, err := helpers.GenerateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating api key: %w", err)
+	}
+
+	apiKey := &models.APIKey{
+		KeyId:       uuid.New().String()[:10],
+		Name:        req.Name,
+		KeyPrefix:   prefix,
+		UserId:      req.UserId,
+		Permissions: req.Permissions,
+		CreatedBy:   &createdBy,
+		ExpiresAt:   expiresAt,
+	}
+	if apiKey.Permissions == nil {
+		apiKey.Permissions = []string{}
+	}
+
+	tx, err := as.DB.Beginx()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+	INSERT INTO api_keys (keyid, name, keyprefix, keyhash, userid, createdby, expiresat)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING createdat
+	`
+	err = tx.Get(&apiKey.CreatedAt, insertQuery,
+		apiKey.KeyId, apiKey.Name, apiKey.KeyPrefix, keyHash, apiKey.UserId, apiKey.CreatedBy, apiKey.ExpiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	for _, permission := range apiKey.Permissions {
+		query := `INSERT INTO api_key_permissions (keyid, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err = tx.Exec(query, apiKey.KeyId, permission)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to store api key permissions: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	return apiKey, key, nil
+}
+
+func (as *APIKeyService) GetAPIKeys() ([]*models.APIKey, error) {
+	keys := []*models.APIKey{}
+	query := `
+	SELECT keyid, name, keyprefix, userid, createdby, expiresat, lastusedat, revokedat, createdat
+	FROM api_keys ORDER BY createdat DESC
+	`
+	err := as.DB.Select(&keys, query)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if key.Permissions, err = as.getPermissions(key.KeyId); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+func (as *APIKeyService) RevokeAPIKey(keyId string) error {
+	query := `UPDATE api_keys SET revokedat = CURRENT_TIMESTAMP WHERE keyid = $1 AND revokedat IS NULL`
+	result, err := as.DB.Exec(query, keyId)
+	if err != nil {
+		return fmt.Errorf("error revoking api key: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error revoking api key: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("api key not found or already revoked")
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks up a usable key and the user it acts as, and records
+// that the key was used.
+func (as *APIKeyService) AuthenticateAPIKey(key string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(key, helpers.APIKeyPrefix) {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+
+	var apiKey models.APIKey
+	keyQuery := `
+	SELECT keyid, name, keyprefix, userid, createdby, expiresat, lastusedat, revokedat, createdat
+	FROM api_keys
+	WHERE keyhash = $1 AND revokedat IS NULL AND expiresat > CURRENT_TIMESTAMP
+	`
+	err := as.DB.Get(&apiKey, keyQuery, helpers.HashOpaqueToken(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+
+	if apiKey.Permissions, err = as.getPermissions(apiKey.KeyId); err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	userQuery := `SELECT userid, name, email, role, verified, createdat, updatedat FROM users WHERE userid = $1`
+	err = as.DB.Get(&user, userQuery, apiKey.UserId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > apiKeyUsageInterval {
+		_, err = as.DB.Exec(`UPDATE api_keys SET lastusedat = CURRENT_TIMESTAMP WHERE keyid = $1`, apiKey.KeyId)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error recording api key use: %w", err)
+		}
+	}
+
+	return &apiKey, &user, nil
+}
+
+func (as *APIKeyService) getPermissions(keyId string) ([]string, error) {
+	permissions := []string{}
+	query := `SELECT permission FROM api_key_permissions WHERE keyid = $1 ORDER BY permission`
+	err := as.DB.Select(&permissions, query, keyId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api key permissions: %w", err)
+	}
+
+	return permissions, nil
+}
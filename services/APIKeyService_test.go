@@ -0,0 +1,35 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+)
+
+func TestCreateAPIKeyForOtherUsersNeedsUsersManage(t *testing.T) {
+	db := testutil.DB(t)
+	as := services.NewAPIKeyService(db, services.NewPermissionService(db))
+
+	creatorId := testutil.User(t, db)
+	otherId := testutil.User(t, db)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM api_keys WHERE userid IN ($1, $2)`, creatorId.String(), otherId.String())
+	})
+
+	holdsNothing := func(string) bool { return false }
+
+	_, _, err := as.CreateAPIKey(&models.APIKeyRequest{Name: "Kiosk", UserId: otherId}, creatorId, holdsNothing)
+	if err == nil || !strings.Contains(err.Error(), models.PermUsersManage) {
+		t.Fatalf("expected a key for another user to need %s, got %v", models.PermUsersManage, err)
+	}
+
+	holdsUsersManage := func(permission string) bool { return permission == models.PermUsersManage }
+	if _, _, err = as.CreateAPIKey(&models.APIKeyRequest{Name: "Kiosk", UserId: otherId}, creatorId, holdsUsersManage); err != nil {
+		t.Fatalf("failed to create key for another user: %v", err)
+	}
+	if _, _, err = as.CreateAPIKey(&models.APIKeyRequest{Name: "Own", UserId: creatorId}, creatorId, holdsNothing); err != nil {
+		t.Fatalf("failed to create own key: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"movie/models"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditoriumService struct {
+	DB *sqlx.DB
+}
+
+func NewAuditoriumService(db *sqlx.DB) *AuditoriumService {
+	return &AuditoriumService{
+		DB: db,
+	}
+}
+
+func (as *AuditoriumService) AddAuditorium(layout *models.AuditoriumLayout) (*models.Auditorium, error) {
+	if layout.Name == "" || len(layout.Rows) == 0 {
+		return nil, fmt.Errorf("auditorium needs a name and at least one row")
+	}
+
+	seats, err := buildSeats(layout.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	auditorium := &models.Auditorium{
+		AuditoriumId: uuid.New().String()[:10],
+	}
+
+	tx, err := as.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+	INSERT INTO auditoriums (auditoriumid, name, venue)
+	VALUES ($1, $2, $3)
+	RETURNING *
+	`
+	err = tx.Get(auditorium, insertQuery, auditorium.AuditoriumId, layout.Name, layout.Venue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert auditorium: %w", err)
+	}
+
+	seatQuery := `
+	INSERT INTO seats (seatid, auditoriumid, rowlabel, rowindex, seatnumber, seattype, aisleleft, aisleright, disabled)
+	VALUES (:seatid, :auditoriumid, :rowlabel, :rowindex, :seatnumber, :seattype, :aisleleft, :aisleright, :disabled)
+	`
+	for i := range seats {
+		seats[i].SeatId = uuid.New().String()[:10]
+		seats[i].AuditoriumId = auditorium.AuditoriumId
+		_, err = tx.NamedExec(seatQuery, seats[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert seat %s%d: %w", seats[i].RowLabel, seats[i].SeatNumber, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit auditorium: %w", err)
+	}
+
+	auditorium.Seats = seats
+	return auditorium, nil
+}
+
+// buildSeats expands the row layouts into individual seats.
+func buildSeats(rows []models.RowLayout) ([]models.Seat, error) {
+	var seats []models.Seat
+	labels := map[string]bool{}
+
+	for i, row := range rows {
+		if row.Label == "" || row.Seats <= 0 {
+			return nil, fmt.Errorf("every row needs a label and a positive number of seats")
+		}
+		if labels[row.Label] {
+			return nil, fmt.Errorf("row %s is defined twice", row.Label)
+		}
+		labels[row.Label] = true
+
+		for n := 1; n <= row.Seats; n++ {
+			seatType := row.SeatType
+			if override, ok := row.SeatTypes[n]; ok {
+				seatType = override
+			}
+			if seatType == "" {
+				seatType = models.SeatTypeStandard
+			}
+			if seatType != models.SeatTypeStandard && seatType != models.SeatTypePremium && seatType != models.SeatTypeWheelchair {
+				return nil, fmt.Errorf("unknown seat type %q in row %s", seatType, row.Label)
+			}
+
+			seats = append(seats, models.Seat{
+				RowLabel:   row.Label,
+				RowIndex:   i,
+				SeatNumber: n,
+				SeatType:   seatType,
+				AisleLeft:  slices.Contains(row.AislesAfter, n-1),
+				AisleRight: slices.Contains(row.AislesAfter, n),
+				Disabled:   slices.Contains(row.DisabledSeats, n),
+			})
+		}
+	}
+
+	return seats, nil
+}
+
+func (as *AuditoriumService) GetAuditoriums() ([]*models.Auditorium, error) {
+	var auditoriums []*models.Auditorium
+	query := `SELECT * FROM auditoriums ORDER BY name`
+	err := as.DB.Select(&auditoriums, query)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching auditoriums: %w", err)
+	}
+
+	return auditoriums, nil
+}
+
+func (as *AuditoriumService) GetAuditoriumById(auditoriumId string) (*models.Auditorium, error) {
+	var auditorium models.Auditorium
+	query := `SELECT * FROM auditoriums WHERE auditoriumid = $1`
+	err := as.DB.Get(&auditorium, query, auditoriumId)
+	if err != nil {
+		return nil, fmt.Errorf("auditorium not found: %w", err)
+	}
+
+	seatQuery := `SELECT * FROM seats WHERE auditoriumid = $1 ORDER BY rowindex, seatnumber`
+	err = as.DB.Select(&auditorium.Seats, seatQuery, auditoriumId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching seats: %w", err)
+	}
+
+	return &auditorium, nil
+}
+
+func (as *AuditoriumService) DeleteAuditorium(auditoriumId string) error {
+	var name string
+	checkQuery := "SELECT name FROM auditoriums WHERE auditoriumid = $1"
+	err := as.DB.Get(&name, checkQuery, auditoriumId)
+	if err != nil {
+		return fmt.Errorf("auditorium not found: %w", err)
+	}
+
+	var showtimes int
+	countQuery := "SELECT COUNT(*) FROM showtimes WHERE auditoriumid = $1"
+	err = as.DB.Get(&showtimes, countQuery, auditoriumId)
+	if err != nil {
+		return fmt.Errorf("failed to delete auditorium: %w", err)
+	}
+	if showtimes > 0 {
+		return fmt.Errorf("auditorium is still used by %d showtimes", showtimes)
+	}
+
+	deleteQuery := "DELETE FROM auditoriums WHERE auditoriumid = $1"
+	_, err = as.DB.Exec(deleteQuery, auditoriumId)
+	if err != nil {
+		return fmt.Errorf("failed to delete auditorium: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const maxGenreNameLength = 50
+
+type GenreService struct {
+	DB *sqlx.DB
+}
+
+func NewGenreService(db *sqlx.DB) *GenreService {
+	return &GenreService{
+		DB: db,
+	}
+}
+
+// genreName checks a genre name and returns it trimmed along with its slug.
+func genreName(name string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	slug := helpers.GenreSlug(name)
+
+	if slug == "" {
+		return "", "", fmt.Errorf("genre name is required")
+	}
+	if len(name) > maxGenreNameLength {
+		return "", "", fmt.Errorf("genre name must be at most %d characters", maxGenreNameLength)
+	}
+
+	return name, slug, nil
+}
+
+// slugTaken reports whether a genre other than exceptGenreId already has the
+// slug, either as its own or as the name of a genre merged into it.
+func slugTaken(q sqlx.Queryer, slug, exceptGenreId string) (bool, error) {
+	var taken bool
+	query := `
+	SELECT EXISTS (SELECT 1 FROM genres WHERE slug = $1 AND genreid <> $2)
+	    OR EXISTS (SELECT 1 FROM genre_aliases WHERE slug = $1 AND genreid <> $2)
+	`
+	err := sqlx.Get(q, &taken, query, slug, exceptGenreId)
+	if err != nil {
+		return false, fmt.Errorf("error checking genre name: %w", err)
+	}
+
+	return taken, nil
+}
+
+func (gs *GenreService) AddGenre(name string) (*models.Genre, error) {
+	name, slug, err := genreName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := slugTaken(gs.DB, slug, "")
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("genre %q already exists", slug)
+	}
+
+	var genre models.Genre
+	query := `
+	INSERT INTO genres (genreid, name, slug)
+	VALUES ($1, $2, $3)
+	RETURNING genreid, name, slug, createdat
+	`
+	err = gs.DB.Get(&genre, query, uuid.New().String()[:10], name, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add genre: %w", err)
+	}
+
+	return &genre, nil
+}
+
+func (gs *GenreService) GetGenres() ([]models.Genre, error) {
+	genres := []models.Genre{}
+	err := gs.DB.Select(&genres, `SELECT genreid, name, slug, createdat FROM genres ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching genres: %w", err)
+	}
+
+	return genres, nil
+}
+
+// RenameGenre changes the name of a genre, its movies keep it.
+func (gs *GenreService) RenameGenre(genreId, name string) (*models.Genre, error) {
+	name, slug, err := genreName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	taken, err := slugTaken(tx, slug, genreId)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("genre %q already exists", slug)
+	}
+
+	var genre models.Genre
+	query := `
+	UPDATE genres SET name = $2, slug = $3
+	WHERE genreid = $1
+	RETURNING genreid, name, slug, createdat
+	`
+	err = tx.Get(&genre, query, genreId, name, slug)
+	if err != nil {
+		return nil, fmt.Errorf("genre not found: %w", err)
+	}
+
+	// an alias that is now the genre's own name is redundant
+	_, err = tx.Exec(`DELETE FROM genre_aliases WHERE slug = $1`, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update genre aliases: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &genre, nil
+}
+
+// DeleteGenre removes a genre from all its movies and deletes it.
+func (gs *GenreService) DeleteGenre(genreId string) error {
+	result, err := gs.DB.Exec(`DELETE FROM genres WHERE genreid = $1`, genreId)
+	if err != nil {
+		return fmt.Errorf("failed to delete genre: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete genre: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("genre not found")
+	}
+
+	return nil
+}
+
+// MergeGenres moves the movies of one genre to another and deletes it, e.g.
+// "Science Fiction" into "Sci-Fi". The merged name stays known as an alias, so
+// filtering by it still finds the movies.
+func (gs *GenreService) MergeGenres(genreId, intoGenreId string) (*models.Genre, error) {
+	if genreId == intoGenreId {
+		return nil, fmt.Errorf("can't merge a genre into itself")
+	}
+
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var merged, into models.Genre
+	query := `SELECT genreid, name, slug, createdat FROM genres WHERE genreid = $1 FOR UPDATE`
+	if err = tx.Get(&merged, query, genreId); err != nil {
+		return nil, fmt.Errorf("genre not found: %w", err)
+	}
+	if err = tx.Get(&into, query, intoGenreId); err != nil {
+		return nil, fmt.Errorf("target genre not found: %w", err)
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO movie_genres (movieid, genreid)
+	SELECT movieid, $2 FROM movie_genres WHERE genreid = $1
+	ON CONFLICT DO NOTHING
+	`, merged.GenreId, into.GenreId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move movies: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE genre_aliases SET genreid = $2 WHERE genreid = $1`, merged.GenreId, into.GenreId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move genre aliases: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO genre_aliases (slug, genreid) VALUES ($1, $2)`, merged.Slug, into.GenreId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add genre alias: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM genres WHERE genreid = $1`, merged.GenreId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete merged genre: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &into, nil
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"movie/helpers"
+	"movie/models"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Holds can be extended, but never past this many hold durations after creation.
+const maxHoldExtensions = 3
+
+type HoldService struct {
+	DB           *sqlx.DB
+	HoldDuration time.Duration
+}
+
+func NewHoldService(db *sqlx.DB) *HoldService {
+	duration := 10 * time.Minute
+	if minutes, err := strconv.Atoi(os.Getenv("SEAT_HOLD_MINUTES")); err == nil && minutes > 0 {
+		duration = time.Duration(minutes) * time.Minute
+	}
+
+	return &HoldService{
+		DB:           db,
+		HoldDuration: duration,
+	}
+}
+
+func (hs *HoldService) CreateHold(userId uuid.UUID, request *models.HoldRequest) (*models.SeatHold, error) {
+	verified, err := helpers.IsUserVerified(hs.DB, userId.String())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %w", err)
+	}
+	if !verified {
+		return nil, fmt.Errorf("email address is not verified")
+	}
+
+	tx, err := hs.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	showtime, err := helpers.LockShowtime(tx, request.ShowtimeId)
+	if err != nil {
+		return nil, fmt.Errorf("showtime not found: %w", err)
+	}
+	if err = helpers.EnsureNotStarted(showtime); err != nil {
+		return nil, err
+	}
+
+	// Don't hold seats the customer could never book
+	_, err = helpers.CheckAgeRestriction(tx, showtime.MovieId, userId, showtime.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	seatIds := helpers.UniqueSeatIds(request.SeatIds)
+	seats, err := helpers.SeatCount(showtime, seatIds, request.Seats)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &models.SeatHold{
+		HoldId:        uuid.New().String()[:10],
+		UserId:        userId,
+		ShowtimeId:    showtime.ShowtimeId,
+		NumberOfSeats: seats,
+		Status:        models.HoldStatusActive,
+		ExpiresAt:     time.Now().Add(hs.HoldDuration),
+	}
+
+	insertQuery := `
+	INSERT INTO seat_holds (holdid, userid, showtimeid, numberofseats, status, expiresat)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING *
+	`
+	err = tx.Get(hold, insertQuery, hold.HoldId, hold.UserId, hold.ShowtimeId, hold.NumberOfSeats, hold.Status, hold.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert hold: %w", err)
+	}
+
+	if showtime.AuditoriumId != nil {
+		hold.Seats, err = helpers.GetSellableSeats(tx, *showtime.AuditoriumId, seatIds)
+		if err != nil {
+			return nil, err
+		}
+
+		err = helpers.EnsureSeatsFree(tx, showtime.ShowtimeId, seatIds, "")
+		if err != nil {
+			return nil, err
+		}
+
+		seatQuery := `
+		INSERT INTO seat_hold_seats (holdid, showtimeid, seatid)
+		VALUES ($1, $2, $3)
+		`
+		for _, seat := range hold.Seats {
+			_, err = tx.Exec(seatQuery, hold.HoldId, hold.ShowtimeId, seat.SeatId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hold seat %s%d: %w", seat.RowLabel, seat.SeatNumber, err)
+			}
+		}
+	}
+
+	err = helpers.TakeSeats(tx, showtime.ShowtimeId, seats)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit hold: %w", err)
+	}
+
+	return hold, nil
+}
+
+func (hs *HoldService) GetHold(userId uuid.UUID, holdId string) (*models.SeatHold, error) {
+	var hold models.SeatHold
+	query := `SELECT * FROM seat_holds WHERE holdid = $1 AND userid = $2`
+	err := hs.DB.Get(&hold, query, holdId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("hold not found: %w", err)
+	}
+
+	hold.Seats, err = getHoldSeats(hs.DB, holdId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// ExtendHold pushes the expiry of an active hold back by one hold duration, up
+// to the extension cap. Holds of showtimes that have started can't be extended.
+func (hs *HoldService) ExtendHold(userId uuid.UUID, holdId string) (*models.SeatHold, error) {
+	var showtime models.Showtime
+	showtimeQuery := `
+	SELECT s.* FROM showtimes s
+	JOIN seat_holds h ON h.showtimeid = s.showtimeid
+	WHERE h.holdid = $1 AND h.userid = $2
+	`
+	err := hs.DB.Get(&showtime, showtimeQuery, holdId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("active hold not found: %w", err)
+	}
+	if err = helpers.EnsureNotStarted(&showtime); err != nil {
+		return nil, err
+	}
+
+	var hold models.SeatHold
+	query := `
+	UPDATE seat_holds
+	SET expiresat = LEAST(CURRENT_TIMESTAMP + $3 * INTERVAL '1 second', createdat + $4 * INTERVAL '1 second'),
+	    updatedat = CURRENT_TIMESTAMP
+	WHERE holdid = $1 AND userid = $2 AND status = 'active' AND expiresat > CURRENT_TIMESTAMP
+	RETURNING *
+	`
+	maxLifetime := hs.HoldDuration * (maxHoldExtensions + 1)
+	err = hs.DB.Get(&hold, query, holdId, userId, hs.HoldDuration.Seconds(), maxLifetime.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("active hold not found: %w", err)
+	}
+
+	hold.Seats, err = getHoldSeats(hs.DB, holdId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+func (hs *HoldService) ReleaseHold(userId uuid.UUID, holdId string) error {
+	tx, err := hs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(tx, holdId)
+	if err != nil || hold.UserId != userId {
+		return fmt.Errorf("active hold not found")
+	}
+
+	err = finishHold(tx, hold, models.HoldStatusReleased)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+
+	return nil
+}
+
+// ConvertHold turns an active hold into a reservation. The held seats were
+// already taken from the showtime, so availableseats is left untouched.
+func (hs *HoldService) ConvertHold(userId uuid.UUID, holdId string) (*models.Reservation, error) {
+	tx, err := hs.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(tx, holdId)
+	if err != nil || hold.UserId != userId {
+		return nil, fmt.Errorf("active hold not found")
+	}
+	if !hold.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("hold has expired")
+	}
+
+	showtime, err := helpers.LockShowtime(tx, hold.ShowtimeId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching showtime data: %w", err)
+	}
+	if err = helpers.EnsureNotStarted(showtime); err != nil {
+		return nil, err
+	}
+
+	// Checked again, the rating or date of birth may have changed meanwhile
+	idCheck, err := helpers.CheckAgeRestriction(tx, showtime.MovieId, hold.UserId, showtime.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := &models.Reservation{
+		ReservationId:   uuid.New().String()[:10],
+		UserId:          hold.UserId,
+		ShowtimeId:      hold.ShowtimeId,
+		NumberOfSeats:   hold.NumberOfSeats,
+		TotalPrice:      float64(hold.NumberOfSeats) * showtime.PricePerSeat,
+		ReservationDate: showtime.StartTime,
+		IdCheckRequired: idCheck,
+	}
+
+	err = helpers.InsertReservation(tx, reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	seats, err := getHoldSeats(tx, holdId)
+	if err != nil {
+		return nil, err
+	}
+	if len(seats) > 0 {
+		err = helpers.EnsureSeatsFree(tx, hold.ShowtimeId, helpers.SeatIdsOf(seats), hold.HoldId)
+		if err != nil {
+			return nil, err
+		}
+
+		err = helpers.AssignSeats(tx, hold.ShowtimeId, reservation.ReservationId, seats)
+		if err != nil {
+			return nil, err
+		}
+		reservation.Seats = seats
+	}
+
+	statusQuery := `UPDATE seat_holds SET status = $2, updatedat = CURRENT_TIMESTAMP WHERE holdid = $1`
+	_, err = tx.Exec(statusQuery, hold.HoldId, models.HoldStatusConverted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert hold: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit reservation: %w", err)
+	}
+
+	return reservation, nil
+}
+
+// ExpireHolds expires every active hold past its expiry and returns the seats to
+// their showtimes. Holds locked by a concurrent conversion are left for the next run.
+func (hs *HoldService) ExpireHolds() (int, error) {
+	tx, err := hs.DB.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var holds []models.SeatHold
+	query := `
+	SELECT * FROM seat_holds
+	WHERE status = 'active' AND expiresat <= CURRENT_TIMESTAMP
+	ORDER BY showtimeid
+	FOR UPDATE SKIP LOCKED
+	`
+	err = tx.Select(&holds, query)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching expired holds: %w", err)
+	}
+
+	for i := range holds {
+		err = finishHold(tx, &holds[i], models.HoldStatusExpired)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to expire holds: %w", err)
+	}
+
+	return len(holds), nil
+}
+
+// StartReaper expires stale holds every interval until stop is called, usually
+// never, i.e. for the lifetime of the process.
+func (hs *HoldService) StartReaper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			expired, err := hs.ExpireHolds()
+			if err != nil {
+				log.Println("Failed to expire seat holds:", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("Expired %d seat holds", expired)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func lockActiveHold(tx *sqlx.Tx, holdId string) (*models.SeatHold, error) {
+	var hold models.SeatHold
+	query := `SELECT * FROM seat_holds WHERE holdid = $1 AND status = 'active' FOR UPDATE`
+	err := tx.Get(&hold, query, holdId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// finishHold ends an active hold and gives its seats back to the showtime.
+func finishHold(tx *sqlx.Tx, hold *models.SeatHold, status string) error {
+	statusQuery := `UPDATE seat_holds SET status = $2, updatedat = CURRENT_TIMESTAMP WHERE holdid = $1`
+	_, err := tx.Exec(statusQuery, hold.HoldId, status)
+	if err != nil {
+		return fmt.Errorf("failed to update hold: %w", err)
+	}
+
+	seatsQuery := `UPDATE showtimes SET availableseats = availableseats + $2 WHERE showtimeid = $1`
+	_, err = tx.Exec(seatsQuery, hold.ShowtimeId, hold.NumberOfSeats)
+	if err != nil {
+		return fmt.Errorf("failed to return held seats: %w", err)
+	}
+
+	hold.Status = status
+	return nil
+}
+
+func getHoldSeats(db sqlx.Queryer, holdId string) ([]models.Seat, error) {
+	var seats []models.Seat
+	query := `
+	SELECT s.* FROM seats s
+	JOIN seat_hold_seats hs ON hs.seatid = s.seatid
+	WHERE hs.holdid = $1
+	ORDER BY s.rowindex, s.seatnumber
+	`
+	err := sqlx.Select(db, &seats, query, holdId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching held seats: %w", err)
+	}
+
+	return seats, nil
+}
@@ -0,0 +1,256 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestConvertHoldChecksAge(t *testing.T) {
+	db := testutil.DB(t)
+	hs := services.NewHoldService(db)
+
+	tests := []struct {
+		name      string
+		birthDate time.Time // zero if unknown
+		err       string    // "" if the hold is converted
+	}{
+		{name: "no date of birth", err: "add your date of birth"},
+		{name: "under age", birthDate: time.Now().AddDate(-16, 0, 0), err: "at least 17"},
+		{name: "old enough", birthDate: time.Now().AddDate(-30, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId := testutil.User(t, db)
+			showtimeId := testutil.Showtime(t, db, 10)
+			if !tt.birthDate.IsZero() {
+				testutil.DateOfBirth(t, db, userId, tt.birthDate)
+			}
+
+			hold, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 2})
+			if err != nil {
+				t.Fatalf("failed to hold seats: %v", err)
+			}
+
+			// The movie is rated while the seats are held
+			testutil.Rate(t, db, showtimeId, "R")
+
+			reservation, err := hs.ConvertHold(userId, hold.HoldId)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				if seats := testutil.BookedSeats(t, db, showtimeId); seats != 0 {
+					t.Errorf("expected no booked seats, got %d", seats)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to convert hold: %v", err)
+			}
+			if !reservation.IdCheckRequired {
+				t.Error("expected the reservation of a restricted film to require an ID check")
+			}
+		})
+	}
+}
+
+// holdStatus reads the status of a hold.
+func holdStatus(t *testing.T, db *sqlx.DB, holdId string) string {
+	t.Helper()
+
+	var status string
+	if err := db.Get(&status, `SELECT status FROM seat_holds WHERE holdid = $1`, holdId); err != nil {
+		t.Fatalf("failed to fetch hold: %v", err)
+	}
+	return status
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	db := testutil.DB(t)
+	hs := services.NewHoldService(db)
+	hs.HoldDuration = time.Minute
+
+	userId := testutil.User(t, db)
+	showtimeId := testutil.Showtime(t, db, 10)
+
+	hold, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 3})
+	if err != nil {
+		t.Fatalf("failed to hold seats: %v", err)
+	}
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 7 {
+		t.Errorf("expected 7 seats left while held, got %d", seats)
+	}
+
+	// Created long enough ago that the extension cap of 4 minutes is near
+	_, err = db.Exec(`UPDATE seat_holds SET createdat = CURRENT_TIMESTAMP - INTERVAL '210 seconds' WHERE holdid = $1`, hold.HoldId)
+	if err != nil {
+		t.Fatalf("failed to age hold: %v", err)
+	}
+	extended, err := hs.ExtendHold(userId, hold.HoldId)
+	if err != nil {
+		t.Fatalf("failed to extend hold: %v", err)
+	}
+	if extended.ExpiresAt.After(time.Now().Add(45 * time.Second)) {
+		t.Errorf("expected the extension to stop at the cap, expires at %s", extended.ExpiresAt)
+	}
+
+	if _, err = hs.ExtendHold(testutil.User(t, db), hold.HoldId); err == nil {
+		t.Error("expected extending another user's hold to fail")
+	}
+
+	if _, err = hs.ConvertHold(userId, hold.HoldId); err != nil {
+		t.Fatalf("failed to convert hold: %v", err)
+	}
+	_, err = hs.ConvertHold(userId, hold.HoldId)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected converting a hold twice to fail, got %v", err)
+	}
+	if _, err = hs.ExtendHold(userId, hold.HoldId); err == nil {
+		t.Error("expected extending a converted hold to fail")
+	}
+
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 7 {
+		t.Errorf("expected 7 seats left after converting, got %d", seats)
+	}
+	if seats := testutil.BookedSeats(t, db, showtimeId); seats != 3 {
+		t.Errorf("expected 3 booked seats, got %d", seats)
+	}
+}
+
+func TestExpireHoldsReturnsSeats(t *testing.T) {
+	db := testutil.DB(t)
+	hs := services.NewHoldService(db)
+
+	userId := testutil.User(t, db)
+	showtimeId := testutil.Showtime(t, db, 10)
+
+	expiring, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 2})
+	if err != nil {
+		t.Fatalf("failed to hold seats: %v", err)
+	}
+	active, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 3})
+	if err != nil {
+		t.Fatalf("failed to hold seats: %v", err)
+	}
+
+	_, err = db.Exec(`UPDATE seat_holds SET expiresat = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE holdid = $1`, expiring.HoldId)
+	if err != nil {
+		t.Fatalf("failed to expire hold: %v", err)
+	}
+
+	_, err = hs.ConvertHold(userId, expiring.HoldId)
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected converting an expired hold to fail, got %v", err)
+	}
+
+	expired, err := hs.ExpireHolds()
+	if err != nil {
+		t.Fatalf("failed to expire holds: %v", err)
+	}
+	if expired < 1 {
+		t.Errorf("expected at least 1 expired hold, got %d", expired)
+	}
+
+	if status := holdStatus(t, db, expiring.HoldId); status != models.HoldStatusExpired {
+		t.Errorf("expected the stale hold to be expired, got %s", status)
+	}
+	if status := holdStatus(t, db, active.HoldId); status != models.HoldStatusActive {
+		t.Errorf("expected the other hold to stay active, got %s", status)
+	}
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 7 {
+		t.Errorf("expected the 2 expired seats back, 7 left, got %d", seats)
+	}
+
+	// Expiring again must not return the seats twice
+	if _, err = hs.ExpireHolds(); err != nil {
+		t.Fatalf("failed to expire holds: %v", err)
+	}
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 7 {
+		t.Errorf("expected 7 seats left, got %d", seats)
+	}
+}
+
+func TestReaperExpiresHolds(t *testing.T) {
+	db := testutil.DB(t)
+	hs := services.NewHoldService(db)
+
+	userId := testutil.User(t, db)
+	showtimeId := testutil.Showtime(t, db, 10)
+
+	hold, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 2})
+	if err != nil {
+		t.Fatalf("failed to hold seats: %v", err)
+	}
+	_, err = db.Exec(`UPDATE seat_holds SET expiresat = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE holdid = $1`, hold.HoldId)
+	if err != nil {
+		t.Fatalf("failed to expire hold: %v", err)
+	}
+
+	stop := hs.StartReaper(10 * time.Millisecond)
+	t.Cleanup(stop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for holdStatus(t, db, hold.HoldId) != models.HoldStatusExpired {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the reaper to expire the hold")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 10 {
+		t.Errorf("expected all seats back, got %d", seats)
+	}
+}
+
+func TestHoldsOfStartedShowtimesAreRefused(t *testing.T) {
+	db := testutil.DB(t)
+	hs := services.NewHoldService(db)
+
+	userId := testutil.User(t, db)
+	showtimeId := testutil.Showtime(t, db, 10)
+
+	hold, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 2})
+	if err != nil {
+		t.Fatalf("failed to hold seats: %v", err)
+	}
+
+	_, err = db.Exec(`UPDATE showtimes SET starttime = CURRENT_TIMESTAMP - INTERVAL '1 minute' WHERE showtimeid = $1`, showtimeId)
+	if err != nil {
+		t.Fatalf("failed to start showtime: %v", err)
+	}
+
+	actions := map[string]func() error{
+		"create": func() error {
+			_, err := hs.CreateHold(userId, &models.HoldRequest{ShowtimeId: showtimeId, Seats: 1})
+			return err
+		},
+		"extend": func() error {
+			_, err := hs.ExtendHold(userId, hold.HoldId)
+			return err
+		},
+		"convert": func() error {
+			_, err := hs.ConvertHold(userId, hold.HoldId)
+			return err
+		},
+	}
+
+	for name, action := range actions {
+		t.Run(name, func(t *testing.T) {
+			if err := action(); err == nil || !strings.Contains(err.Error(), "already started") {
+				t.Errorf("expected the started showtime to be refused, got %v", err)
+			}
+		})
+	}
+
+	if seats := testutil.BookedSeats(t, db, showtimeId); seats != 0 {
+		t.Errorf("expected no booked seats, got %d", seats)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Failed logins are counted per account and per client IP. Once a key reaches
+// its threshold every further failure locks it for twice as long as the last
+// one, up to maxLockout. Counters start over after a day without failures.
+const (
+	accountFailureThreshold = 5
+	ipFailureThreshold      = 20
+	mfaFailureThreshold     = 5
+	baseLockout             = time.Minute
+	maxLockout              = time.Hour
+)
+
+type LoginAttemptService struct {
+	DB *sqlx.DB
+}
+
+func NewLoginAttemptService(db *sqlx.DB) *LoginAttemptService {
+	return &LoginAttemptService{
+		DB: db,
+	}
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MFAKey counts wrong two-factor codes. Unlike the account key it is not reset
+// by a correct password, only by a correct code.
+func MFAKey(userId string) string {
+	return "mfa:" + userId
+}
+
+// LockedFor returns how long the longest lock among the keys still lasts.
+func (ls *LoginAttemptService) LockedFor(keys ...string) (time.Duration, error) {
+	var lockedUntil *time.Time
+	query := `SELECT MAX(lockeduntil) FROM login_failures WHERE key = ANY($1) AND lockeduntil > CURRENT_TIMESTAMP`
+	err := ls.DB.Get(&lockedUntil, query, pq.Array(keys))
+	if err != nil {
+		return 0, fmt.Errorf("error checking login lockout: %w", err)
+	}
+	if lockedUntil == nil {
+		return 0, nil
+	}
+
+	return time.Until(*lockedUntil), nil
+}
+
+// RecordFailure counts a failed login against the key and locks it once the
+// threshold is reached. It returns the number of failures so far.
+func (ls *LoginAttemptService) RecordFailure(key string, threshold int) (int, error) {
+	var failures int
+	upsertQuery := `
+	INSERT INTO login_failures (key, failures, lastfailureat)
+	VALUES ($1, 1, CURRENT_TIMESTAMP)
+	ON CONFLICT (key) DO UPDATE SET
+	  failures = CASE
+	    WHEN login_failures.lastfailureat < CURRENT_TIMESTAMP - INTERVAL '1 day' THEN 1
+	    ELSE login_failures.failures + 1
+	  END,
+	  lastfailureat = CURRENT_TIMESTAMP
+	RETURNING failures
+	`
+	err := ls.DB.Get(&failures, upsertQuery, key)
+	if err != nil {
+		return 0, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	if failures < threshold {
+		return failures, nil
+	}
+
+	lockout := maxLockout
+	if over := failures - threshold; over < 16 {
+		lockout = min(baseLockout<<over, maxLockout)
+	}
+
+	lockQuery := `UPDATE login_failures SET lockeduntil = $2 WHERE key = $1`
+	_, err = ls.DB.Exec(lockQuery, key, time.Now().Add(lockout))
+	if err != nil {
+		return failures, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	return failures, nil
+}
+
+// RecordFailures counts a failed login for the account and the client IP.
+func (ls *LoginAttemptService) RecordFailures(email, ip string) error {
+	if _, err := ls.RecordFailure(AccountKey(email), accountFailureThreshold); err != nil {
+		return err
+	}
+	_, err := ls.RecordFailure(IPKey(ip), ipFailureThreshold)
+	return err
+}
+
+// Reset clears the failures and any lock of the key.
+func (ls *LoginAttemptService) Reset(key string) error {
+	_, err := ls.DB.Exec(`DELETE FROM login_failures WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("error resetting failed logins: %w", err)
+	}
+
+	return nil
+}
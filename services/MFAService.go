@@ -0,0 +1,382 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const recoveryCodeCount = 10
+
+// MFARequiredError is returned by a login that still needs a second factor.
+// Token is the short-lived mfa pending token to exchange at VerifyLogin.
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// MFAService handles TOTP (RFC 6238) enrollment and second factor checks.
+type MFAService struct {
+	DB       *sqlx.DB
+	Tokens   *TokenService
+	Attempts *LoginAttemptService
+}
+
+func NewMFAService(db *sqlx.DB, tokenService *TokenService, attempts *LoginAttemptService) *MFAService {
+	return &MFAService{
+		DB:       db,
+		Tokens:   tokenService,
+		Attempts: attempts,
+	}
+}
+
+var errInvalidCode = errors.New("invalid two-factor code")
+
+func (ms *MFAService) IsEnabled(userId string) (bool, error) {
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE userid = $1 AND enabled)`
+	err := ms.DB.Get(&enabled, query, userId)
+	if err != nil {
+		return false, fmt.Errorf("error checking two-factor authentication: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// Enroll creates a new, not yet enabled TOTP secret for the user. Enrollment
+// only takes effect once a code generated from it is confirmed.
+func (ms *MFAService) Enroll(userId, email string) (*models.MFAEnrollment, error) {
+	enabled, err := ms.IsEnabled(userId)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error generating secret: %w", err)
+	}
+
+	query := `
+	INSERT INTO user_mfa (userid, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (userid) DO UPDATE SET secret = EXCLUDED.secret, lastusedstep = 0, createdat = CURRENT_TIMESTAMP
+	`
+	_, err = ms.DB.Exec(query, userId, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error storing secret: %w", err)
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "MovieReservation"
+	}
+
+	return &models.MFAEnrollment{
+		Secret: secret,
+		URL:    helpers.TOTPURL(issuer, email, secret),
+	}, nil
+}
+
+// Confirm enables two-factor authentication after checking a code from the
+// enrolled secret, and returns the recovery codes. They are only shown once.
+func (ms *MFAService) Confirm(userId, code string) ([]string, error) {
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	mfa, err := lockMFA(tx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("no two-factor enrollment found, enroll first")
+	}
+	if mfa.Enabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	if err = useTOTPCode(tx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE user_mfa SET enabled = true, enabledat = CURRENT_TIMESTAMP WHERE userid = $1`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off. Staff accounts can't, it is
+// mandatory for every role other than user.
+func (ms *MFAService) Disable(userId, code string) error {
+	var role string
+	err := ms.DB.Get(&role, `SELECT role FROM users WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if role != models.RoleUser {
+		return fmt.Errorf("two-factor authentication is mandatory for staff accounts")
+	}
+
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	mfa, err := lockMFA(tx, userId)
+	if err != nil || !mfa.Enabled {
+		return fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	if err = checkSecondFactor(tx, mfa, code); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_mfa WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP code.
+func (ms *MFAService) RegenerateRecoveryCodes(userId, code string) ([]string, error) {
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	mfa, err := lockMFA(tx, userId)
+	if err != nil || !mfa.Enabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	if err = useTOTPCode(tx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error storing recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// VerifyLogin exchanges an mfa pending token and a TOTP or recovery code for a
+// full access/refresh pair. The pending token can only be used once. Wrong codes
+// count against the account and the client IP like wrong passwords; once the
+// account is locked the pending token is revoked too.
+func (ms *MFAService) VerifyLogin(mfaToken, code string, client models.Client) (*models.User, string, string, error) {
+	tokenId, userId, expiresAt, err := helpers.ParseMFAToken(mfaToken)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	revoked, err := ms.Tokens.Revocations.IsTokenRevoked(tokenId)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if revoked {
+		return nil, "", "", fmt.Errorf("invalid mfa token: already used")
+	}
+
+	lockedFor, err := ms.Attempts.LockedFor(MFAKey(userId), IPKey(client.IP))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if lockedFor > 0 {
+		return nil, "", "", fmt.Errorf("too many failed login attempts, try again in %s", lockedFor.Round(time.Second))
+	}
+
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	mfa, err := lockMFA(tx, userId)
+	if err != nil || !mfa.Enabled {
+		return nil, "", "", fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	if err = checkSecondFactor(tx, mfa, code); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			if failErr := ms.recordFailure(tokenId, userId, expiresAt, client); failErr != nil {
+				return nil, "", "", failErr
+			}
+		}
+		return nil, "", "", err
+	}
+
+	var user models.User
+	userQuery := `
+	SELECT userid, name, email, role, verified, createdat, updatedat
+	FROM users WHERE userid = $1 AND suspendedat IS NULL AND deletedat IS NULL
+	`
+	err = tx.Get(&user, userQuery, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", "", fmt.Errorf("invalid mfa token: account is suspended or deleted")
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, "", "", fmt.Errorf("error verifying code: %w", err)
+	}
+
+	if err = ms.Tokens.Revocations.RevokeToken(tokenId, expiresAt); err != nil {
+		return nil, "", "", err
+	}
+
+	if err = ms.Attempts.Reset(MFAKey(userId)); err != nil {
+		return nil, "", "", err
+	}
+
+	accessToken, refreshToken, err := ms.Tokens.IssueTokens(&user, true, client)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return &user, accessToken, refreshToken, nil
+}
+
+// recordFailure counts a wrong code. When the account reaches its threshold the
+// pending token is revoked, so guessing has to start over with the password,
+// which is then refused while the lock lasts.
+func (ms *MFAService) recordFailure(tokenId, userId string, expiresAt time.Time, client models.Client) error {
+	failures, err := ms.Attempts.RecordFailure(MFAKey(userId), mfaFailureThreshold)
+	if err != nil {
+		return err
+	}
+	if _, err = ms.Attempts.RecordFailure(IPKey(client.IP), ipFailureThreshold); err != nil {
+		return err
+	}
+
+	if failures >= mfaFailureThreshold {
+		return ms.Tokens.Revocations.RevokeToken(tokenId, expiresAt)
+	}
+
+	return nil
+}
+
+type userMFA struct {
+	UserId       string `db:"userid"`
+	Secret       string `db:"secret"`
+	Enabled      bool   `db:"enabled"`
+	LastUsedStep int64  `db:"lastusedstep"`
+}
+
+func lockMFA(tx *sqlx.Tx, userId string) (*userMFA, error) {
+	var mfa userMFA
+	query := `SELECT userid, secret, enabled, lastusedstep FROM user_mfa WHERE userid = $1 FOR UPDATE`
+	err := tx.Get(&mfa, query, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// useTOTPCode checks a TOTP code and burns its time step, so an observed code
+// can't be replayed within its validity window.
+func useTOTPCode(tx *sqlx.Tx, mfa *userMFA, code string) error {
+	step, ok := helpers.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok || step <= mfa.LastUsedStep {
+		return errInvalidCode
+	}
+
+	_, err := tx.Exec(`UPDATE user_mfa SET lastusedstep = $2 WHERE userid = $1`, mfa.UserId, step)
+	if err != nil {
+		return fmt.Errorf("error verifying code: %w", err)
+	}
+
+	return nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+func checkSecondFactor(tx *sqlx.Tx, mfa *userMFA, code string) error {
+	if err := useTOTPCode(tx, mfa, code); err == nil {
+		return nil
+	}
+
+	query := `
+	UPDATE mfa_recovery_codes
+	SET usedat = CURRENT_TIMESTAMP
+	WHERE userid = $1 AND codehash = $2 AND usedat IS NULL
+	`
+	result, err := tx.Exec(query, mfa.UserId, helpers.HashOpaqueToken(helpers.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("error verifying code: %w", err)
+	}
+
+	used, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error verifying code: %w", err)
+	}
+	if used == 0 {
+		return errInvalidCode
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sqlx.Tx, userId string) ([]string, error) {
+	codes, err := helpers.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("error generating recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE userid = $1`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error storing recovery codes: %w", err)
+	}
+
+	for _, code := range codes {
+		query := `INSERT INTO mfa_recovery_codes (codehash, userid) VALUES ($1, $2)`
+		_, err = tx.Exec(query, helpers.HashOpaqueToken(helpers.NormalizeRecoveryCode(code)), userId)
+		if err != nil {
+			return nil, fmt.Errorf("error storing recovery codes: %w", err)
+		}
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{"plain", "The Dark Knight", "The Dark Knight"},
+		{"highlight", "The " + highlightStart + "Dark" + highlightStop + " Knight", "The <b>Dark</b> Knight"},
+		{
+			"markup in the text",
+			highlightStart + "<script>" + highlightStop + `alert("x")</script>`,
+			"<b>&lt;script&gt;</b>alert(&#34;x&#34;)&lt;/script&gt;",
+		},
+		{"tags in the text", "<b>bold</b> & <i>", "&lt;b&gt;bold&lt;/b&gt; &amp; &lt;i&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightHTML(tt.headline); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,13 +2,44 @@ package services
 
 import (
 	"fmt"
+	"html"
+	"movie/helpers"
 	"movie/models"
 	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// movieColumns are the columns of models.Movie. Queries name them instead of
+// using * since movies also holds the search vector.
+const movieColumns = "movieid, title, description, duration, director, posterimage, releasedate, ratingsystem, rating, createdat, updatedat"
+
+// ts_headline marks matches with these private use characters instead of tags.
+// They are stripped from the text first, so after HTML-escaping the headline
+// they can only stand for the highlights.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// highlightText is the SQL for a headline source column with the markers removed.
+func highlightText(column string) string {
+	return "translate(" + column + ", '" + highlightStart + highlightStop + "', '')"
+}
+
+// highlightOptions are ts_headline options using the markers.
+func highlightOptions(options string) string {
+	return "'" + options + `, StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"'`
+}
+
+// highlightHTML escapes a headline and turns its markers into <b> tags.
+func highlightHTML(headline string) string {
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(html.EscapeString(headline))
+}
+
 type MovieService struct {
 	DB *sqlx.DB
 }
@@ -22,24 +53,49 @@ func NewMovieService(db *sqlx.DB) *MovieService {
 func (ms *MovieService) AddMovie(movie *models.Movie) (*models.Movie, error) {
 	movie.MovieId = uuid.New().String()[:10]
 
+	err := checkContentRating(ms.DB, movie.RatingSystem, movie.Rating)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-	INSERT INTO movies (movieid, title, description, genre, duration, director, posterimage, releasedate)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	RETURNING *
-	`
-	err := ms.DB.Get(movie, query,
+	INSERT INTO movies (movieid, title, description, duration, director, posterimage, releasedate, ratingsystem, rating)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING ` + movieColumns
+	err = tx.Get(movie, query,
 		movie.MovieId,
 		movie.Title,
 		movie.Description,
-		movie.Genre,
 		movie.Duration,
 		movie.Director,
 		movie.PosterImage,
 		movie.ReleaseDate,
+		movie.RatingSystem,
+		movie.Rating,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	err = setMovieGenres(tx, movie.MovieId, movie.GenreIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = ms.loadGenres(movie)
+	if err != nil {
+		return nil, err
+	}
 	return movie, nil
 }
 
@@ -60,15 +116,127 @@ func (ms *MovieService) DeleteMovie(movieId string) error {
 	return nil
 }
 
-func (ms *MovieService) GetMovies() ([]*models.Movie, error) {
-	var movies []*models.Movie
-	fetchQuery := "SELECT * FROM movies"
-	err := ms.DB.Select(&movies, fetchQuery)
+// movieSortColumns maps the sort keys of the catalogue to their columns.
+var movieSortColumns = map[string]string{
+	"title":       "title",
+	"releaseDate": "releasedate",
+	"duration":    "duration",
+	"createdAt":   "createdat",
+}
+
+// GetMovies returns one page of the movies matching the filter, along with the
+// number of all matches.
+func (ms *MovieService) GetMovies(filter models.MovieFilter, page, pageSize int) (*models.MoviePage, error) {
+	conditions := []string{}
+	args := []any{}
+	argIndex := 1
+
+	if filter.Genre != "" {
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM movie_genres mg
+		JOIN genres g ON g.genreid = mg.genreid
+		WHERE mg.movieid = movies.movieid
+		  AND (g.slug = $%[1]d OR g.genreid IN (SELECT genreid FROM genre_aliases WHERE slug = $%[1]d)))`, argIndex))
+		args = append(args, helpers.GenreSlug(filter.Genre))
+		argIndex++
+	}
+	if filter.Director != "" {
+		conditions = append(conditions, fmt.Sprintf("director ILIKE '%%' || $%d || '%%'", argIndex))
+		args = append(args, helpers.EscapeLike(filter.Director))
+		argIndex++
+	}
+	if filter.ReleasedFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("releasedate >= $%d", argIndex))
+		args = append(args, *filter.ReleasedFrom)
+		argIndex++
+	}
+	if filter.ReleasedTo != nil {
+		conditions = append(conditions, fmt.Sprintf("releasedate <= $%d", argIndex))
+		args = append(args, *filter.ReleasedTo)
+		argIndex++
+	}
+	if filter.MinDuration > 0 {
+		conditions = append(conditions, fmt.Sprintf("duration >= $%d", argIndex))
+		args = append(args, filter.MinDuration)
+		argIndex++
+	}
+	if filter.MaxDuration > 0 {
+		conditions = append(conditions, fmt.Sprintf("duration <= $%d", argIndex))
+		args = append(args, filter.MaxDuration)
+		argIndex++
+	}
+
+	switch filter.Status {
+	case "":
+	case models.MovieNowShowing:
+		conditions = append(conditions, `releasedate <= CURRENT_TIMESTAMP
+		AND EXISTS (SELECT 1 FROM showtimes s WHERE s.movieid = movies.movieid AND s.starttime > CURRENT_TIMESTAMP)`)
+	case models.MovieComingSoon:
+		conditions = append(conditions, "releasedate > CURRENT_TIMESTAMP")
+	default:
+		return nil, fmt.Errorf("unknown status %q, use %s or %s", filter.Status, models.MovieNowShowing, models.MovieComingSoon)
+	}
+
+	orderBy, err := movieOrder(filter.Sort)
 	if err != nil {
 		return nil, err
 	}
 
-	return movies, nil
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	result := &models.MoviePage{
+		Movies:     []*models.Movie{},
+		Pagination: models.Pagination{Page: page, PageSize: pageSize},
+	}
+
+	err = ms.DB.Get(&result.Total, "SELECT COUNT(*) FROM movies "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error counting movies: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM movies
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, movieColumns, where, orderBy, argIndex, argIndex+1)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	err = ms.DB.Select(&result.Movies, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching movies: %w", err)
+	}
+
+	err = ms.loadGenres(result.Movies...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// movieOrder turns a sort key into an ORDER BY clause. The movie id breaks ties
+// so that pages don't overlap.
+func movieOrder(sort string) (string, error) {
+	if sort == "" {
+		sort = "title"
+	}
+
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+
+	column, ok := movieSortColumns[sort]
+	if !ok {
+		return "", fmt.Errorf("unknown sort key %q", sort)
+	}
+
+	return fmt.Sprintf("%s %s, movieid %s", column, direction, direction), nil
 }
 
 func (ms *MovieService) UpdateMovies(movie *models.Movie) (*models.Movie, error) {
@@ -86,11 +254,6 @@ func (ms *MovieService) UpdateMovies(movie *models.Movie) (*models.Movie, error)
 		args = append(args, movie.Description)
 		argIndex++
 	}
-	if movie.Genre != "" {
-		setClauses = append(setClauses, fmt.Sprintf("genre = $%d", argIndex))
-		args = append(args, movie.Genre)
-		argIndex++
-	}
 	if movie.Duration != 0 {
 		setClauses = append(setClauses, fmt.Sprintf("duration = $%d", argIndex))
 		args = append(args, movie.Duration)
@@ -111,6 +274,19 @@ func (ms *MovieService) UpdateMovies(movie *models.Movie) (*models.Movie, error)
 		args = append(args, movie.ReleaseDate)
 		argIndex++
 	}
+	if movie.ClearRating {
+		if movie.RatingSystem != nil || movie.Rating != nil {
+			return nil, fmt.Errorf("clearRating must not be combined with ratingSystem or rating")
+		}
+		setClauses = append(setClauses, "ratingsystem = NULL, rating = NULL")
+	} else if movie.RatingSystem != nil || movie.Rating != nil {
+		if err := checkContentRating(ms.DB, movie.RatingSystem, movie.Rating); err != nil {
+			return nil, err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("ratingsystem = $%d, rating = $%d", argIndex, argIndex+1))
+		args = append(args, *movie.RatingSystem, *movie.Rating)
+		argIndex += 2
+	}
 
 	// Always update updatedat
 	setClauses = append(setClauses, "updatedat = CURRENT_TIMESTAMP")
@@ -124,26 +300,318 @@ func (ms *MovieService) UpdateMovies(movie *models.Movie) (*models.Movie, error)
 		UPDATE movies
 		SET %s
 		WHERE movieid = $%d
-		RETURNING *
-	`, strings.Join(setClauses, ", "), argIndex)
+		RETURNING %s
+	`, strings.Join(setClauses, ", "), argIndex, movieColumns)
 
 	args = append(args, movie.MovieId)
 
-	err := ms.DB.Get(movie, query, args...)
+	tx, err := ms.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.Get(movie, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update movie: %w", err)
 	}
 
+	// only replace the genres if the update names them, [] clears them
+	if movie.GenreIds != nil {
+		err = setMovieGenres(tx, movie.MovieId, movie.GenreIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = ms.loadGenres(movie)
+	if err != nil {
+		return nil, err
+	}
+
 	return movie, nil
 }
 
 func (ms *MovieService) GetMovieById(movieId string) (*models.Movie, error) {
 	var movie models.Movie
-	query := `SELECT * FROM movies WHERE movieid =  $1`
+	query := `SELECT ` + movieColumns + ` FROM movies WHERE movieid = $1`
 	err := ms.DB.Get(&movie, query, movieId)
 	if err != nil {
 		return nil, fmt.Errorf("movie not found: %w", err)
 	}
 
+	err = ms.loadGenres(&movie)
+	if err != nil {
+		return nil, err
+	}
+
+	movie.Credits, err = ms.getCredits(movie.MovieId)
+	if err != nil {
+		return nil, err
+	}
+
 	return &movie, nil
 }
+
+// SearchMovies finds movies by words of their title, director or description.
+// Every word matches as a prefix ("inter" finds "Interstellar"), and titles or
+// directors that are merely similar still match to tolerate typos.
+func (ms *MovieService) SearchMovies(search string, page, pageSize int) (*models.MovieSearchPage, error) {
+	search = strings.TrimSpace(search)
+	tsQuery := prefixTSQuery(search)
+	if tsQuery == "" {
+		return nil, fmt.Errorf("search query is empty")
+	}
+
+	result := &models.MovieSearchPage{
+		Query:      search,
+		Hits:       []models.MovieSearchHit{},
+		Pagination: models.Pagination{Page: page, PageSize: pageSize},
+	}
+
+	// $1 is the prefix tsquery, $2 the raw text for trigram similarity
+	matches := `
+	FROM movies, to_tsquery('english', $1) AS query
+	WHERE searchvector @@ query
+	   OR $2 <% title
+	   OR $2 <% director
+	`
+
+	err := ms.DB.Get(&result.Total, `SELECT COUNT(*) `+matches, tsQuery, search)
+	if err != nil {
+		return nil, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	query := `
+	SELECT ` + movieColumns + `,
+	  ts_rank(searchvector, query) + GREATEST(word_similarity($2, title), word_similarity($2, director)) AS rank,
+	  ts_headline('english', ` + highlightText("title") + `, query, ` + highlightOptions("HighlightAll=true") + `) AS titlehighlight,
+	  ts_headline('english', ` + highlightText("director") + `, query, ` + highlightOptions("HighlightAll=true") + `) AS directorhighlight,
+	  ts_headline('english', ` + highlightText("COALESCE(description, '')") + `, query,
+	    ` + highlightOptions("MaxFragments=2, MinWords=5, MaxWords=20") + `) AS descriptionhighlight
+	` + matches + `
+	ORDER BY rank DESC, movieid
+	LIMIT $3 OFFSET $4
+	`
+
+	var rows []struct {
+		models.Movie
+		Rank                 float64 `db:"rank"`
+		TitleHighlight       string  `db:"titlehighlight"`
+		DirectorHighlight    string  `db:"directorhighlight"`
+		DescriptionHighlight string  `db:"descriptionhighlight"`
+	}
+	err = ms.DB.Select(&rows, query, tsQuery, search, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("error searching movies: %w", err)
+	}
+
+	movies := make([]*models.Movie, len(rows))
+	for i := range rows {
+		movies[i] = &rows[i].Movie
+	}
+	err = ms.loadGenres(movies...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result.Hits = append(result.Hits, models.MovieSearchHit{
+			Movie: row.Movie,
+			Rank:  row.Rank,
+			Highlights: models.MovieHighlights{
+				Title:       highlightHTML(row.TitleHighlight),
+				Director:    highlightHTML(row.DirectorHighlight),
+				Description: highlightHTML(row.DescriptionHighlight),
+			},
+		})
+	}
+
+	return result, nil
+}
+
+// checkContentRating makes sure a movie's rating is one of content_ratings.
+// Movies may also be unrated.
+func checkContentRating(q sqlx.Queryer, ratingSystem, rating *string) error {
+	if ratingSystem == nil && rating == nil {
+		return nil
+	}
+	if ratingSystem == nil || rating == nil {
+		return fmt.Errorf("ratingSystem and rating must be set together")
+	}
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM content_ratings WHERE ratingsystem = $1 AND rating = $2)`
+	err := sqlx.Get(q, &exists, query, *ratingSystem, *rating)
+	if err != nil {
+		return fmt.Errorf("error checking content rating: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("unknown content rating %s %s", *ratingSystem, *rating)
+	}
+
+	return nil
+}
+
+// GetContentRatings lists the ratings of every rating system, youngest first.
+func (ms *MovieService) GetContentRatings() ([]models.ContentRating, error) {
+	ratings := []models.ContentRating{}
+	query := `
+	SELECT ratingsystem, rating, minimumage, description
+	FROM content_ratings
+	ORDER BY ratingsystem, minimumage, rating
+	`
+	err := ms.DB.Select(&ratings, query)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching content ratings: %w", err)
+	}
+
+	return ratings, nil
+}
+
+// SetContentRating adds a rating to a rating system or changes its minimum age.
+// The new age applies to bookings made from now on.
+func (ms *MovieService) SetContentRating(rating *models.ContentRating) (*models.ContentRating, error) {
+	rating.RatingSystem = strings.TrimSpace(rating.RatingSystem)
+	rating.Rating = strings.TrimSpace(rating.Rating)
+	if rating.RatingSystem == "" || rating.Rating == "" {
+		return nil, fmt.Errorf("ratingSystem and rating are required")
+	}
+	if rating.MinimumAge < 0 {
+		return nil, fmt.Errorf("minimumAge must not be negative")
+	}
+
+	query := `
+	INSERT INTO content_ratings (ratingsystem, rating, minimumage, description)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (ratingsystem, rating) DO UPDATE
+	SET minimumage = EXCLUDED.minimumage, description = EXCLUDED.description
+	RETURNING ratingsystem, rating, minimumage, description
+	`
+	err := ms.DB.Get(rating, query, rating.RatingSystem, rating.Rating, rating.MinimumAge, rating.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set content rating: %w", err)
+	}
+
+	return rating, nil
+}
+
+// setMovieGenres replaces the genres of a movie.
+func setMovieGenres(tx *sqlx.Tx, movieId string, genreIds []string) error {
+	_, err := tx.Exec(`DELETE FROM movie_genres WHERE movieid = $1`, movieId)
+	if err != nil {
+		return fmt.Errorf("failed to clear movie genres: %w", err)
+	}
+
+	unique := map[string]bool{}
+	for _, genreId := range genreIds {
+		unique[genreId] = true
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+
+	result, err := tx.Exec(`
+	INSERT INTO movie_genres (movieid, genreid)
+	SELECT $1, genreid FROM genres WHERE genreid = ANY($2)
+	`, movieId, pq.Array(genreIds))
+	if err != nil {
+		return fmt.Errorf("failed to set movie genres: %w", err)
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set movie genres: %w", err)
+	}
+	if int(added) != len(unique) {
+		return fmt.Errorf("unknown genre in genreIds")
+	}
+
+	return nil
+}
+
+// loadGenres fills in the genres of the movies.
+func (ms *MovieService) loadGenres(movies ...*models.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	byId := map[string]*models.Movie{}
+	movieIds := []string{}
+	for _, movie := range movies {
+		movie.Genres = []models.Genre{}
+		byId[movie.MovieId] = movie
+		movieIds = append(movieIds, movie.MovieId)
+	}
+
+	var rows []struct {
+		MovieId string `db:"movieid"`
+		models.Genre
+	}
+	query := `
+	SELECT mg.movieid, g.genreid, g.name, g.slug, g.createdat
+	FROM movie_genres mg
+	JOIN genres g ON g.genreid = mg.genreid
+	WHERE mg.movieid = ANY($1)
+	ORDER BY g.name
+	`
+	err := ms.DB.Select(&rows, query, pq.Array(movieIds))
+	if err != nil {
+		return fmt.Errorf("error fetching movie genres: %w", err)
+	}
+
+	for _, row := range rows {
+		movie := byId[row.MovieId]
+		movie.Genres = append(movie.Genres, row.Genre)
+	}
+
+	return nil
+}
+
+// getCredits returns the cast in billing order and the crew by role.
+func (ms *MovieService) getCredits(movieId string) (*models.MovieCredits, error) {
+	var credits []models.Credit
+	query := `
+	SELECT c.creditid, c.movieid, c.personid, c.role, COALESCE(c.charactername, '') AS charactername,
+	       c.billingorder, p.name, p.photoimage
+	FROM movie_credits c
+	JOIN people p ON p.personid = c.personid
+	WHERE c.movieid = $1
+	ORDER BY c.role, c.billingorder, p.name
+	`
+	err := ms.DB.Select(&credits, query, movieId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching credits: %w", err)
+	}
+
+	result := &models.MovieCredits{Cast: []models.Credit{}, Crew: []models.Credit{}}
+	for _, credit := range credits {
+		if credit.Role == models.CreditActor {
+			result.Cast = append(result.Cast, credit)
+		} else {
+			result.Crew = append(result.Crew, credit)
+		}
+	}
+
+	return result, nil
+}
+
+// prefixTSQuery turns free text into a tsquery matching all of its words as
+// prefixes, e.g. "dark knig" becomes "dark:* & knig:*". Everything but letters
+// and digits is dropped so user input can't inject tsquery operators.
+func prefixTSQuery(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, word+":*")
+	}
+
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSearchMoviesEscapesHighlights(t *testing.T) {
+	db := testutil.DB(t)
+	ms := services.NewMovieService(db)
+
+	word := "zq" + uuid.New().String()[:8]
+	title := `<img src=x onerror=alert(1)> ` + word + " \ue000injected" // a stray highlight marker
+	movieId := uuid.New().String()[:10]
+	query := `
+	INSERT INTO movies (movieid, title, description, duration, director, posterimage, releasedate)
+	VALUES ($1, $2, $3, 90, '<script>alert(1)</script>', 'poster.jpg', CURRENT_TIMESTAMP)
+	`
+	if _, err := db.Exec(query, movieId, title, "<b>"+word+"</b> in a description"); err != nil {
+		t.Fatalf("failed to create movie: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM movies WHERE movieid = $1`, movieId) })
+
+	page, err := ms.SearchMovies(word, 1, 10)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(page.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(page.Hits))
+	}
+
+	highlights := page.Hits[0].Highlights
+	for name, highlight := range map[string]string{
+		"title":       highlights.Title,
+		"director":    highlights.Director,
+		"description": highlights.Description,
+	} {
+		withoutBold := strings.NewReplacer("<b>", "", "</b>", "").Replace(highlight)
+		if strings.ContainsAny(withoutBold, "<>") || strings.Count(highlight, "<b>") != strings.Count(highlight, "</b>") {
+			t.Errorf("%s highlight has unescaped markup: %q", name, highlight)
+		}
+	}
+	if !strings.Contains(highlights.Title, "<b>"+word+"</b>") {
+		t.Errorf("expected %s to be highlighted in %q", word, highlights.Title)
+	}
+	if !strings.Contains(highlights.Description, "&lt;b&gt;<b>"+word+"</b>&lt;/b&gt;") {
+		t.Errorf("expected the description's own tags to be escaped in %q", highlights.Description)
+	}
+}
+
+func TestUpdateMoviesClearsRating(t *testing.T) {
+	db := testutil.DB(t)
+	ms := services.NewMovieService(db)
+
+	movieId := uuid.New().String()[:10]
+	query := `
+	INSERT INTO movies (movieid, title, duration, director, posterimage, releasedate, ratingsystem, rating)
+	VALUES ($1, 'Rated Movie', 90, 'Test Director', 'poster.jpg', CURRENT_TIMESTAMP, 'MPAA', 'R')
+	`
+	if _, err := db.Exec(query, movieId); err != nil {
+		t.Fatalf("failed to create movie: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM movies WHERE movieid = $1`, movieId) })
+
+	rating := "PG"
+	_, err := ms.UpdateMovies(&models.Movie{MovieId: movieId, ClearRating: true, Rating: &rating})
+	if err == nil || !strings.Contains(err.Error(), "must not be combined") {
+		t.Fatalf("expected clearing and setting a rating at once to fail, got %v", err)
+	}
+
+	movie, err := ms.UpdateMovies(&models.Movie{MovieId: movieId, ClearRating: true})
+	if err != nil {
+		t.Fatalf("failed to clear rating: %v", err)
+	}
+	if movie.RatingSystem != nil || movie.Rating != nil {
+		t.Error("expected the movie to be unrated")
+	}
+	if movie.Title != "Rated Movie" {
+		t.Errorf("expected the other fields to stay, got title %q", movie.Title)
+	}
+}
+
+func TestGetMoviesDirectorFilterIsLiteral(t *testing.T) {
+	db := testutil.DB(t)
+	ms := services.NewMovieService(db)
+
+	marker := uuid.New().String()[:8]
+	directors := []string{marker + " 100% Films", marker + " 100 Films", marker + " 1_0"}
+	for _, director := range directors {
+		movieId := uuid.New().String()[:10]
+		query := `
+		INSERT INTO movies (movieid, title, duration, director, posterimage, releasedate)
+		VALUES ($1, 'Test Movie', 90, $2, 'poster.jpg', CURRENT_TIMESTAMP)
+		`
+		if _, err := db.Exec(query, movieId, director); err != nil {
+			t.Fatalf("failed to create movie: %v", err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM movies WHERE movieid = $1`, movieId) })
+	}
+
+	tests := []struct {
+		director string
+		want     int
+	}{
+		{marker + " 100%", 1},
+		{marker + " 100", 2},
+		{marker + " 1_", 1},
+		{marker + " 1%0", 0},
+	}
+
+	for _, tt := range tests {
+		page, err := ms.GetMovies(models.MovieFilter{Director: tt.director}, 1, 10)
+		if err != nil {
+			t.Fatalf("failed to list movies: %v", err)
+		}
+		if page.Total != tt.want {
+			t.Errorf("director %q: expected %d movies, got %d", tt.director, tt.want, page.Total)
+		}
+	}
+}
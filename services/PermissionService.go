@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"movie/models"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Role permissions are cached for this long, changes made through the service
+// apply immediately on this instance.
+const permissionCacheTTL = time.Minute
+
+type PermissionService struct {
+	DB *sqlx.DB
+
+	mu       sync.RWMutex
+	cache    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+func NewPermissionService(db *sqlx.DB) *PermissionService {
+	return &PermissionService{
+		DB: db,
+	}
+}
+
+func (ps *PermissionService) HasPermission(role, permission string) (bool, error) {
+	ps.mu.RLock()
+	fresh := ps.cache != nil && time.Since(ps.loadedAt) < permissionCacheTTL
+	granted := ps.cache[role]
+	ps.mu.RUnlock()
+
+	if !fresh {
+		if err := ps.reload(); err != nil {
+			return false, err
+		}
+		ps.mu.RLock()
+		granted = ps.cache[role]
+		ps.mu.RUnlock()
+	}
+
+	return granted[models.PermAll] || granted[permission], nil
+}
+
+func (ps *PermissionService) reload() error {
+	var rows []struct {
+		Role       string `db:"role"`
+		Permission string `db:"permission"`
+	}
+	err := ps.DB.Select(&rows, `SELECT role, permission FROM role_permissions`)
+	if err != nil {
+		return fmt.Errorf("error loading role permissions: %w", err)
+	}
+
+	cache := map[string]map[string]bool{}
+	for _, row := range rows {
+		if cache[row.Role] == nil {
+			cache[row.Role] = map[string]bool{}
+		}
+		cache[row.Role][row.Permission] = true
+	}
+
+	ps.mu.Lock()
+	ps.cache = cache
+	ps.loadedAt = time.Now()
+	ps.mu.Unlock()
+
+	return nil
+}
+
+func (ps *PermissionService) GetRoles() ([]*models.Role, error) {
+	var roles []*models.Role
+	err := ps.DB.Select(&roles, `SELECT name, description FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching roles: %w", err)
+	}
+
+	for _, role := range roles {
+		role.Permissions = []string{}
+		query := `SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission`
+		err = ps.DB.Select(&role.Permissions, query, role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching role permissions: %w", err)
+		}
+	}
+
+	return roles, nil
+}
+
+// SetRolePermissions creates the role if needed and replaces its permissions.
+// Like API keys, a role can only be granted permissions its editor holds
+// (editorHolds).
+func (ps *PermissionService) SetRolePermissions(role *models.Role, editorHolds func(permission string) bool) (*models.Role, error) {
+	if role.Name == "" {
+		return nil, fmt.Errorf("role name is required")
+	}
+	if role.Name == models.RoleUser && len(role.Permissions) > 0 {
+		return nil, fmt.Errorf("the user role can't be granted permissions")
+	}
+	for _, permission := range role.Permissions {
+		if !models.IsPermission(permission) {
+			return nil, fmt.Errorf("permissions must be known permissions, %q is not", permission)
+		}
+		if !editorHolds(permission) {
+			return nil, fmt.Errorf("can't grant permission %s you don't hold", permission)
+		}
+	}
+
+	tx, err := ps.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	upsertQuery := `
+	INSERT INTO roles (name, description)
+	VALUES ($1, $2)
+	ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description
+	`
+	_, err = tx.Exec(upsertQuery, role.Name, role.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store role: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM role_permissions WHERE role = $1`, role.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store role permissions: %w", err)
+	}
+
+	for _, permission := range role.Permissions {
+		query := `INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err = tx.Exec(query, role.Name, permission)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store role permissions: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to store role: %w", err)
+	}
+
+	if err = ps.reload(); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
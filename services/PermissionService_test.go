@@ -0,0 +1,55 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSetRolePermissionsOnlyGrantsHeldPermissions(t *testing.T) {
+	db := testutil.DB(t)
+	ps := services.NewPermissionService(db)
+
+	name := "test-" + uuid.New().String()[:8]
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM role_permissions WHERE role = $1`, name)
+		db.Exec(`DELETE FROM roles WHERE name = $1`, name)
+	})
+
+	editorHolds := func(permission string) bool { return permission == models.PermMoviesManage }
+
+	tests := []struct {
+		name        string
+		permissions []string
+		err         string // "" if the role is stored
+	}{
+		{"unknown permission", []string{"movies:delete-all"}, "known permissions"},
+		{"permission the editor lacks", []string{models.PermUsersManage}, "don't hold"},
+		{"every permission", []string{models.PermAll}, "don't hold"},
+		{"held permission", []string{models.PermMoviesManage}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ps.SetRolePermissions(&models.Role{Name: name, Permissions: tt.permissions}, editorHolds)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("failed to set role permissions: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	granted, err := ps.HasPermission(name, models.PermUsersManage)
+	if err != nil || granted {
+		t.Errorf("expected the role not to hold %s, got %v, %v", models.PermUsersManage, granted, err)
+	}
+}
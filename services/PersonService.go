@@ -0,0 +1,253 @@
+package services
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const maxPersonNameLength = 100
+
+// personColumns are the columns of models.Person.
+const personColumns = "personid, name, birthdate, biography, photoimage, createdat, updatedat"
+
+type PersonService struct {
+	DB *sqlx.DB
+}
+
+func NewPersonService(db *sqlx.DB) *PersonService {
+	return &PersonService{
+		DB: db,
+	}
+}
+
+func validPersonName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if len(name) > maxPersonNameLength {
+		return "", fmt.Errorf("name must be at most %d characters long", maxPersonNameLength)
+	}
+	return name, nil
+}
+
+func (ps *PersonService) AddPerson(person *models.Person) (*models.Person, error) {
+	name, err := validPersonName(person.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO people (personid, name, birthdate, biography, photoimage)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING ` + personColumns
+	err = ps.DB.Get(person, query,
+		uuid.New().String()[:10],
+		name,
+		person.BirthDate,
+		person.Biography,
+		person.PhotoImage,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add person: %w", err)
+	}
+
+	return person, nil
+}
+
+// UpdatePerson changes the non-empty fields of the person.
+func (ps *PersonService) UpdatePerson(person *models.Person) (*models.Person, error) {
+	setClauses := []string{}
+	args := []any{}
+	argIndex := 1
+
+	if person.Name != "" {
+		name, err := validPersonName(person.Name)
+		if err != nil {
+			return nil, err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("name = $%d", argIndex))
+		args = append(args, name)
+		argIndex++
+	}
+	if person.BirthDate != nil {
+		setClauses = append(setClauses, fmt.Sprintf("birthdate = $%d", argIndex))
+		args = append(args, *person.BirthDate)
+		argIndex++
+	}
+	if person.Biography != "" {
+		setClauses = append(setClauses, fmt.Sprintf("biography = $%d", argIndex))
+		args = append(args, person.Biography)
+		argIndex++
+	}
+	if person.PhotoImage != "" {
+		setClauses = append(setClauses, fmt.Sprintf("photoimage = $%d", argIndex))
+		args = append(args, person.PhotoImage)
+		argIndex++
+	}
+
+	setClauses = append(setClauses, "updatedat = CURRENT_TIMESTAMP")
+
+	query := fmt.Sprintf(`
+		UPDATE people
+		SET %s
+		WHERE personid = $%d
+		RETURNING %s
+	`, strings.Join(setClauses, ", "), argIndex, personColumns)
+
+	args = append(args, person.PersonId)
+
+	err := ps.DB.Get(person, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("person not found or failed to update: %w", err)
+	}
+
+	return person, nil
+}
+
+// DeletePerson deletes a person along with all their credits.
+func (ps *PersonService) DeletePerson(personId string) error {
+	result, err := ps.DB.Exec(`DELETE FROM people WHERE personid = $1`, personId)
+	if err != nil {
+		return fmt.Errorf("failed to delete person: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete person: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("person not found")
+	}
+
+	return nil
+}
+
+// GetPeople returns one page of the people whose name contains the search.
+func (ps *PersonService) GetPeople(search string, page, pageSize int) (*models.PeoplePage, error) {
+	where := `WHERE ($1 = '' OR name ILIKE '%' || $1 || '%')`
+	search = helpers.EscapeLike(search)
+
+	result := &models.PeoplePage{
+		People:     []models.Person{},
+		Pagination: models.Pagination{Page: page, PageSize: pageSize},
+	}
+
+	err := ps.DB.Get(&result.Total, `SELECT COUNT(*) FROM people `+where, search)
+	if err != nil {
+		return nil, fmt.Errorf("error counting people: %w", err)
+	}
+
+	query := `
+	SELECT ` + personColumns + `
+	FROM people ` + where + `
+	ORDER BY name, personid
+	LIMIT $2 OFFSET $3
+	`
+	err = ps.DB.Select(&result.People, query, search, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching people: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetFilmography returns a person with every movie they are credited on.
+func (ps *PersonService) GetFilmography(personId string) (*models.Filmography, error) {
+	filmography := &models.Filmography{Credits: []models.FilmographyEntry{}}
+
+	err := ps.DB.Get(&filmography.Person, `SELECT `+personColumns+` FROM people WHERE personid = $1`, personId)
+	if err != nil {
+		return nil, fmt.Errorf("person not found: %w", err)
+	}
+
+	query := `
+	SELECT c.creditid, c.role, COALESCE(c.charactername, '') AS charactername,
+	       m.movieid, m.title, m.posterimage, m.releasedate
+	FROM movie_credits c
+	JOIN movies m ON m.movieid = c.movieid
+	WHERE c.personid = $1
+	ORDER BY m.releasedate DESC, m.movieid, c.role
+	`
+	err = ps.DB.Select(&filmography.Credits, query, personId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching filmography: %w", err)
+	}
+
+	return filmography, nil
+}
+
+// AddCredit credits a person on a movie. Only actors play a character.
+func (ps *PersonService) AddCredit(credit *models.Credit) (*models.Credit, error) {
+	switch credit.Role {
+	case models.CreditActor:
+	case models.CreditDirector, models.CreditWriter, models.CreditComposer:
+		if credit.Character != "" {
+			return nil, fmt.Errorf("only actors can have a character")
+		}
+	default:
+		return nil, fmt.Errorf("role must be one of %s, %s, %s or %s",
+			models.CreditActor, models.CreditDirector, models.CreditWriter, models.CreditComposer)
+	}
+	if credit.MovieId == "" || credit.PersonId == "" {
+		return nil, fmt.Errorf("movieId and personId are required")
+	}
+
+	query := `
+	INSERT INTO movie_credits (creditid, movieid, personid, role, charactername, billingorder)
+	SELECT $1, m.movieid, p.personid, $4, NULLIF($5, ''), $6
+	FROM movies m, people p
+	WHERE m.movieid = $2 AND p.personid = $3
+	ON CONFLICT DO NOTHING
+	RETURNING creditid, movieid, personid, role, COALESCE(charactername, '') AS charactername, billingorder
+	`
+	var added []models.Credit
+	err := ps.DB.Select(&added, query,
+		uuid.New().String()[:10],
+		credit.MovieId,
+		credit.PersonId,
+		credit.Role,
+		strings.TrimSpace(credit.Character),
+		credit.BillingOrder,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add credit: %w", err)
+	}
+
+	if len(added) == 0 {
+		var exists bool
+		err = ps.DB.Get(&exists, `SELECT EXISTS (SELECT 1 FROM movies WHERE movieid = $1) AND EXISTS (SELECT 1 FROM people WHERE personid = $2)`,
+			credit.MovieId, credit.PersonId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add credit: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("movie or person not found")
+		}
+		return nil, fmt.Errorf("credit already exists")
+	}
+
+	return &added[0], nil
+}
+
+func (ps *PersonService) DeleteCredit(creditId string) error {
+	result, err := ps.DB.Exec(`DELETE FROM movie_credits WHERE creditid = $1`, creditId)
+	if err != nil {
+		return fmt.Errorf("failed to delete credit: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete credit: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("credit not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/services"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetPeopleSearchIsLiteral(t *testing.T) {
+	db := testutil.DB(t)
+	ps := services.NewPersonService(db)
+
+	marker := uuid.New().String()[:8]
+	for _, name := range []string{marker + " 100% Real", marker + " 100 Real", marker + " A_B"} {
+		personId := uuid.New().String()[:10]
+		if _, err := db.Exec(`INSERT INTO people (personid, name) VALUES ($1, $2)`, personId, name); err != nil {
+			t.Fatalf("failed to create person: %v", err)
+		}
+		t.Cleanup(func() { db.Exec(`DELETE FROM people WHERE personid = $1`, personId) })
+	}
+
+	tests := []struct {
+		search string
+		want   int
+	}{
+		{marker, 3},
+		{marker + " 100%", 1},
+		{marker + " 100", 2},
+		{marker + " A_", 1},
+		{marker + " _", 0},
+	}
+
+	for _, tt := range tests {
+		page, err := ps.GetPeople(tt.search, 1, 10)
+		if err != nil {
+			t.Fatalf("failed to search people: %v", err)
+		}
+		if page.Total != tt.want {
+			t.Errorf("search %q: expected %d people, got %d", tt.search, tt.want, page.Total)
+		}
+	}
+}
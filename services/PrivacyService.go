@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PrivacyService answers data subject requests: exporting everything stored
+// about a user and erasing the user's personal data.
+type PrivacyService struct {
+	DB     *sqlx.DB
+	Tokens *TokenService
+}
+
+func NewPrivacyService(db *sqlx.DB, tokenService *TokenService) *PrivacyService {
+	return &PrivacyService{
+		DB:     db,
+		Tokens: tokenService,
+	}
+}
+
+// Export collects the personal data of a user. Secrets like the password hash,
+// the TOTP secret and API key hashes are left out.
+func (ps *PrivacyService) Export(userId string) (*models.PersonalDataExport, error) {
+	export := &models.PersonalDataExport{
+		ExportedAt:   time.Now().UTC(),
+		Reservations: []models.Reservation{},
+		SeatHolds:    []models.SeatHold{},
+		Sessions:     []models.Session{},
+		Identities:   []models.UserIdentity{},
+		APIKeys:      []models.APIKey{},
+	}
+
+	profileQuery := `
+	SELECT userid, name, email, role, verified, dateofbirth, suspendedat, suspensionreason, deletedat, createdat, updatedat
+	FROM users WHERE userid = $1
+	`
+	err := ps.DB.Get(&export.Profile, profileQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	mfaQuery := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE userid = $1 AND enabled)`
+	err = ps.DB.Get(&export.TwoFactorEnabled, mfaQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting two-factor state: %w", err)
+	}
+
+	reservationQuery := `SELECT * FROM reservations WHERE userid = $1 ORDER BY reservationdate`
+	err = ps.DB.Select(&export.Reservations, reservationQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting reservations: %w", err)
+	}
+	for i := range export.Reservations {
+		seats, err := helpers.GetReservationSeats(ps.DB, export.Reservations[i].ReservationId)
+		if err != nil {
+			return nil, fmt.Errorf("error exporting reserved seats: %w", err)
+		}
+		export.Reservations[i].Seats = seats
+	}
+
+	holdQuery := `SELECT * FROM seat_holds WHERE userid = $1 ORDER BY createdat`
+	err = ps.DB.Select(&export.SeatHolds, holdQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting seat holds: %w", err)
+	}
+
+	sessionQuery := `
+	SELECT familyid, useragent, ipaddress, mfa, createdat, lastseenat, revokedat
+	FROM refresh_token_families WHERE userid = $1 ORDER BY createdat
+	`
+	err = ps.DB.Select(&export.Sessions, sessionQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting sessions: %w", err)
+	}
+	for i := range export.Sessions {
+		export.Sessions[i].Device = helpers.DescribeDevice(export.Sessions[i].UserAgent)
+	}
+
+	identityQuery := `SELECT issuer, subject, email, createdat, lastloginat FROM user_identities WHERE userid = $1`
+	err = ps.DB.Select(&export.Identities, identityQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting linked identities: %w", err)
+	}
+
+	apiKeyQuery := `
+	SELECT keyid, name, keyprefix, userid, createdby, expiresat, lastusedat, revokedat, createdat
+	FROM api_keys WHERE userid = $1 ORDER BY createdat
+	`
+	err = ps.DB.Select(&export.APIKeys, apiKeyQuery, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting api keys: %w", err)
+	}
+	for i := range export.APIKeys {
+		export.APIKeys[i].Permissions = []string{}
+		permissionQuery := `SELECT permission FROM api_key_permissions WHERE keyid = $1 ORDER BY permission`
+		err = ps.DB.Select(&export.APIKeys[i].Permissions, permissionQuery, export.APIKeys[i].KeyId)
+		if err != nil {
+			return nil, fmt.Errorf("error exporting api key permissions: %w", err)
+		}
+	}
+
+	return export, nil
+}
+
+// EraseUser erases another user on an admin's behalf. Like suspending, it is
+// refused for the admin's own account and for users whose role holds
+// permissions the admin lacks (adminHolds).
+func (ps *PrivacyService) EraseUser(userId, adminId string, adminHolds func(permission string) bool) error {
+	if err := checkAdminTarget(ps.DB, userId, adminId, adminHolds); err != nil {
+		return err
+	}
+
+	return ps.Erase(userId)
+}
+
+// Erase anonymizes a user. The row stays so reservations keep pointing at it and
+// remain usable for accounting, but name, email and password are replaced and
+// everything else tied to the person is deleted. Upcoming reservations and
+// active holds are cancelled first. Erasure can't be undone.
+func (ps *PrivacyService) Erase(userId string) error {
+	tx, err := ps.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.Get(&email, `SELECT email FROM users WHERE userid = $1 FOR UPDATE`, userId)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if err = releaseUserBookings(tx, userId); err != nil {
+		return err
+	}
+
+	// Placeholder address, unique per user and within the email column length
+	anonymousEmail := "erased-" + strings.ReplaceAll(userId, "-", "") + "@invalid"
+
+	anonymizeQuery := `
+	UPDATE users
+	SET name = 'Erased user', email = $2, password = '', role = 'user', verified = false, dateofbirth = NULL,
+	    suspensionreason = NULL, deletedat = COALESCE(deletedat, CURRENT_TIMESTAMP), updatedat = CURRENT_TIMESTAMP
+	WHERE userid = $1
+	`
+	_, err = tx.Exec(anonymizeQuery, userId, anonymousEmail)
+	if err != nil {
+		return fmt.Errorf("error erasing user: %w", err)
+	}
+
+	for _, query := range []string{
+		`DELETE FROM seat_holds WHERE userid = $1`,
+		`DELETE FROM refresh_token_families WHERE userid = $1`,
+		`DELETE FROM email_verifications WHERE userid = $1`,
+		`DELETE FROM password_resets WHERE userid = $1`,
+		`DELETE FROM user_mfa WHERE userid = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE userid = $1`,
+		`DELETE FROM user_identities WHERE userid = $1`,
+		`DELETE FROM api_keys WHERE userid = $1`, // permissions cascade
+	} {
+		if _, err = tx.Exec(query, userId); err != nil {
+			return fmt.Errorf("error erasing user: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM login_failures WHERE key = $1`, AccountKey(email))
+	if err != nil {
+		return fmt.Errorf("error erasing user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error erasing user: %w", err)
+	}
+
+	return ps.Tokens.LogoutAll(userId)
+}
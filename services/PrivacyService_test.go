@@ -0,0 +1,55 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/services"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPrivacyCoversAPIKeys(t *testing.T) {
+	db := testutil.DB(t)
+	ps := services.NewPrivacyService(db, services.NewTokenService(db, services.NewMemoryRevocationStore()))
+
+	userId := testutil.User(t, db)
+	keyId := uuid.New().String()[:10]
+	keyQuery := `
+	INSERT INTO api_keys (keyid, name, keyprefix, keyhash, userid, expiresat)
+	VALUES ($1, 'Kiosk', 'mrk_test', $2, $3, $4)
+	`
+	_, err := db.Exec(keyQuery, keyId, uuid.New().String(), userId.String(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO api_key_permissions (keyid, permission) VALUES ($1, 'reservations:read')`, keyId)
+	if err != nil {
+		t.Fatalf("failed to grant api key permission: %v", err)
+	}
+
+	export, err := ps.Export(userId.String())
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if len(export.APIKeys) != 1 {
+		t.Fatalf("expected 1 api key, got %d", len(export.APIKeys))
+	}
+	key := export.APIKeys[0]
+	if key.KeyId != keyId || key.Name != "Kiosk" || !slices.Equal(key.Permissions, []string{"reservations:read"}) {
+		t.Errorf("unexpected api key %+v", key)
+	}
+
+	if err = ps.Erase(userId.String()); err != nil {
+		t.Fatalf("failed to erase: %v", err)
+	}
+
+	var keys int
+	if err = db.Get(&keys, `SELECT COUNT(*) FROM api_keys WHERE userid = $1`, userId.String()); err != nil {
+		t.Fatalf("failed to count api keys: %v", err)
+	}
+	if keys != 0 {
+		t.Errorf("expected erasure to delete the api keys, %d left", keys)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"movie/helpers"
 	"movie/models"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,34 +14,84 @@ import (
 
 type ReservationService struct {
 	DB *sqlx.DB
+	// No cancellations closer than this to the start of a showtime
+	CancellationCutoff time.Duration
 }
 
 func NewReservationService(db *sqlx.DB) *ReservationService {
+	cutoff := 2 * time.Hour
+	if minutes, err := strconv.Atoi(os.Getenv("CANCELLATION_CUTOFF_MINUTES")); err == nil && minutes >= 0 {
+		cutoff = time.Duration(minutes) * time.Minute
+	}
+
 	return &ReservationService{
-		DB: db,
+		DB:                 db,
+		CancellationCutoff: cutoff,
 	}
 }
 
 func (rs *ReservationService) GetUpcomingEvents(userId string) (*[]models.Reservation, error) {
 	var events []models.Reservation
-	query := `SELECT * FROM reservations WHERE userid = $1 AND reservationdate > CURRENT_TIMESTAMP`
+	query := `
+	SELECT * FROM reservations
+	WHERE userid = $1 AND status = 'confirmed' AND reservationdate > CURRENT_TIMESTAMP
+	`
 
 	err := rs.DB.Select(&events, query, userId)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching upcoming events: %w", err)
 	}
 
+	if err = rs.attachSeats(events); err != nil {
+		return nil, err
+	}
+
 	return &events, nil
 }
 
+// attachSeats loads the booked seats of every reservation in place.
+func (rs *ReservationService) attachSeats(reservations []models.Reservation) error {
+	for i := range reservations {
+		seats, err := helpers.GetReservationSeats(rs.DB, reservations[i].ReservationId)
+		if err != nil {
+			return fmt.Errorf("error fetching reserved seats: %w", err)
+		}
+		reservations[i].Seats = seats
+	}
+	return nil
+}
+
 func (rs *ReservationService) BookSeats(bookingData *models.BookingData) (*models.Reservation, error) {
-	showtime, err := helpers.GetShowtimeData(rs.DB, bookingData.ShowtimeId)
+	verified, err := helpers.IsUserVerified(rs.DB, bookingData.UserId.String())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %w", err)
+	}
+	if !verified {
+		return nil, fmt.Errorf("email address is not verified")
+	}
+
+	// Start a transaction, the showtime row stays locked until it ends
+	tx, err := rs.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	showtime, err := helpers.LockShowtime(tx, bookingData.ShowtimeId)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching showtime data: %w", err)
 	}
 
-	if showtime.AvailableSeats < bookingData.Seats {
-		return nil, fmt.Errorf("not enough seats available, only %d are left", showtime.AvailableSeats)
+	// Checked for the customer even when staff book on their behalf
+	idCheck, err := helpers.CheckAgeRestriction(tx, showtime.MovieId, bookingData.UserId, showtime.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	seatIds := helpers.UniqueSeatIds(bookingData.SeatIds)
+	bookingData.Seats, err = helpers.SeatCount(showtime, seatIds, bookingData.Seats)
+	if err != nil {
+		return nil, err
 	}
 
 	reservation := &models.Reservation{
@@ -49,73 +101,86 @@ func (rs *ReservationService) BookSeats(bookingData *models.BookingData) (*model
 		NumberOfSeats:   bookingData.Seats,
 		TotalPrice:      float64(bookingData.Seats) * showtime.PricePerSeat,
 		ReservationDate: showtime.StartTime,
+		IdCheckRequired: idCheck,
 	}
 
-	// Start a transaction
-	tx, err := rs.DB.Beginx()
+	err = helpers.InsertReservation(tx, reservation)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p)
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
+
+	if showtime.AuditoriumId != nil {
+		reservation.Seats, err = helpers.GetSellableSeats(tx, *showtime.AuditoriumId, seatIds)
+		if err != nil {
+			return nil, err
 		}
-	}()
 
-	insertQuery := `
-		INSERT INTO reservations (reservationid, userid, showtimeid, numberofseats, totalprice, reservationdate)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING *
-	`
+		err = helpers.EnsureSeatsFree(tx, showtime.ShowtimeId, seatIds, "")
+		if err != nil {
+			return nil, err
+		}
 
-	err = tx.Get(reservation, insertQuery,
-		reservation.ReservationId,
-		reservation.UserId,
-		reservation.ShowtimeId,
-		reservation.NumberOfSeats,
-		reservation.TotalPrice,
-		reservation.ReservationDate,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert reservation: %w", err)
+		err = helpers.AssignSeats(tx, showtime.ShowtimeId, reservation.ReservationId, reservation.Seats)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	updateSeatsQuery := `
-		UPDATE showtimes
-		SET availableseats = $2
-		WHERE showtimeid = $1
-	`
-
-	newSeats := showtime.AvailableSeats - bookingData.Seats
-	_, err = tx.Exec(updateSeatsQuery, bookingData.ShowtimeId, newSeats)
+	// Conditional decrement, never trusts the value read above
+	err = helpers.TakeSeats(tx, showtime.ShowtimeId, bookingData.Seats)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update available seats: %w", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit reservation: %w", err)
 	}
 
 	return reservation, nil
 }
 
-func (rs *ReservationService) CancelReservation(reservationId string) error {
-	var reservationDate time.Time
+// CancelReservation marks a reservation of userId as cancelled and gives its seats
+// back to the showtime, unless the showtime starts within the cancellation cutoff.
+func (rs *ReservationService) CancelReservation(reservationId string, userId uuid.UUID) error {
+	tx, err := rs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var reservation models.Reservation
 	fetchQuery := `
-	SELECT reservationdate FROM reservations WHERE reservationid = $1
+	SELECT * FROM reservations WHERE reservationid = $1 FOR UPDATE
 	`
-	err := rs.DB.Get(&reservationDate, fetchQuery, reservationId)
+	err = tx.Get(&reservation, fetchQuery, reservationId)
 	if err != nil {
 		return fmt.Errorf("reservation not found: %w", err)
 	}
 
-	deleteQuery := `
-	DELETE FROM reservations WHERE reservationid = $1
-	`
-	_, err = rs.DB.Exec(deleteQuery, reservationId)
+	if reservation.UserId != userId {
+		return fmt.Errorf("reservation belongs to another user")
+	}
+
+	if reservation.Status == models.ReservationCancelled {
+		return fmt.Errorf("reservation is already cancelled")
+	}
+
+	showtime, err := helpers.LockShowtime(tx, reservation.ShowtimeId)
 	if err != nil {
-		return fmt.Errorf("error deleting reservation: %w", err)
+		return fmt.Errorf("error fetching showtime data: %w", err)
+	}
+
+	if time.Until(showtime.StartTime) < rs.CancellationCutoff {
+		return fmt.Errorf("reservations cannot be cancelled within %s of the showtime", rs.CancellationCutoff)
+	}
+
+	err = helpers.ReleaseReservation(tx, &reservation)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error cancelling reservation: %w", err)
 	}
 
 	return nil
@@ -130,6 +195,10 @@ func (rs *ReservationService) GetAllUserReservations(userId string) (*[]models.R
 		return nil, fmt.Errorf("error fetching upcoming events: %w", err)
 	}
 
+	if err = rs.attachSeats(events); err != nil {
+		return nil, err
+	}
+
 	return &events, nil
 }
 
@@ -0,0 +1,220 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBookSeatsConcurrently(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+
+	const capacity = 10
+	const attempts = 50
+	showtimeId := testutil.Showtime(t, db, capacity)
+	userId := testutil.User(t, db)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	booked := 0
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+			if err != nil {
+				if !strings.Contains(err.Error(), "not enough seats") {
+					t.Errorf("unexpected booking error: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			booked++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if booked != capacity {
+		t.Errorf("expected %d successful bookings, got %d", capacity, booked)
+	}
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 0 {
+		t.Errorf("expected no seats left, got %d", seats)
+	}
+	if seats := testutil.BookedSeats(t, db, showtimeId); seats != capacity {
+		t.Errorf("expected %d booked seats, got %d", capacity, seats)
+	}
+}
+
+func TestBookAndCancelConcurrently(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+
+	const capacity = 10
+	showtimeId := testutil.Showtime(t, db, capacity)
+	userId := testutil.User(t, db)
+
+	var reservationIds []string
+	for range capacity / 2 {
+		reservation, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+		if err != nil {
+			t.Fatalf("failed to book seat: %v", err)
+		}
+		reservationIds = append(reservationIds, reservation.ReservationId)
+	}
+
+	// Cancellations race bookings for the seats they give back
+	var wg sync.WaitGroup
+	for _, reservationId := range reservationIds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rs.CancelReservation(reservationId, userId); err != nil {
+				t.Errorf("failed to cancel reservation: %v", err)
+			}
+		}()
+	}
+	for range 3 * capacity {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+			if err != nil && !strings.Contains(err.Error(), "not enough seats") {
+				t.Errorf("unexpected booking error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	available := testutil.AvailableSeats(t, db, showtimeId)
+	if available < 0 {
+		t.Errorf("available seats went negative: %d", available)
+	}
+	if booked := testutil.BookedSeats(t, db, showtimeId); booked+available != capacity {
+		t.Errorf("seats lost: %d booked and %d available out of %d", booked, available, capacity)
+	}
+}
+
+func TestCancelReservationOfAnotherUser(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+
+	showtimeId := testutil.Showtime(t, db, 5)
+	ownerId := testutil.User(t, db)
+	otherId := testutil.User(t, db)
+
+	reservation, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: ownerId, Seats: 2})
+	if err != nil {
+		t.Fatalf("failed to book seats: %v", err)
+	}
+
+	err = rs.CancelReservation(reservation.ReservationId, otherId)
+	if err == nil || !strings.Contains(err.Error(), "belongs to another user") {
+		t.Fatalf("expected cancelling another user's reservation to fail, got %v", err)
+	}
+
+	var status string
+	err = db.Get(&status, `SELECT status FROM reservations WHERE reservationid = $1`, reservation.ReservationId)
+	if err != nil {
+		t.Fatalf("failed to fetch reservation: %v", err)
+	}
+	if status != models.ReservationConfirmed {
+		t.Errorf("expected reservation to stay %s, got %s", models.ReservationConfirmed, status)
+	}
+	if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 3 {
+		t.Errorf("expected 3 seats left, got %d", seats)
+	}
+}
+
+func TestReservationListsOnlyHaveOwnReservations(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+
+	showtimeId := testutil.Showtime(t, db, 5)
+	ownerId := testutil.User(t, db)
+	otherId := testutil.User(t, db)
+
+	for _, userId := range []uuid.UUID{ownerId, otherId} {
+		_, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+		if err != nil {
+			t.Fatalf("failed to book seats: %v", err)
+		}
+	}
+
+	upcoming, err := rs.GetUpcomingEvents(ownerId.String())
+	if err != nil {
+		t.Fatalf("failed to fetch upcoming events: %v", err)
+	}
+	all, err := rs.GetAllUserReservations(ownerId.String())
+	if err != nil {
+		t.Fatalf("failed to fetch reservations: %v", err)
+	}
+
+	for name, reservations := range map[string][]models.Reservation{"upcoming": *upcoming, "all": *all} {
+		if len(reservations) != 1 {
+			t.Errorf("%s: expected 1 reservation, got %d", name, len(reservations))
+		}
+		for _, reservation := range reservations {
+			if reservation.UserId != ownerId {
+				t.Errorf("%s: got reservation %s of user %s", name, reservation.ReservationId, reservation.UserId)
+			}
+		}
+	}
+}
+
+func TestBookSeatsChecksAge(t *testing.T) {
+	db := testutil.DB(t)
+	rs := services.NewReservationService(db)
+
+	tests := []struct {
+		name      string
+		rating    string    // "" leaves the movie unrated
+		birthDate time.Time // zero if unknown
+		err       string    // "" if the booking goes through
+		idCheck   bool
+	}{
+		{name: "unrated, no date of birth"},
+		{name: "rated, no date of birth", rating: "R", err: "add your date of birth"},
+		{name: "rated, under age", rating: "R", birthDate: time.Now().AddDate(-16, 0, 0), err: "at least 17"},
+		{name: "rated, old enough", rating: "R", birthDate: time.Now().AddDate(-30, 0, 0), idCheck: true},
+		{name: "rated for everyone", rating: "PG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId := testutil.User(t, db)
+			showtimeId := testutil.Showtime(t, db, 10)
+			if tt.rating != "" {
+				testutil.Rate(t, db, showtimeId, tt.rating)
+			}
+			if !tt.birthDate.IsZero() {
+				testutil.DateOfBirth(t, db, userId, tt.birthDate)
+			}
+
+			reservation, err := rs.BookSeats(&models.BookingData{ShowtimeId: showtimeId, UserId: userId, Seats: 1})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				if seats := testutil.AvailableSeats(t, db, showtimeId); seats != 10 {
+					t.Errorf("expected all 10 seats left, got %d", seats)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to book: %v", err)
+			}
+			if reservation.IdCheckRequired != tt.idCheck {
+				t.Errorf("expected idCheckRequired %v, got %v", tt.idCheck, reservation.IdCheckRequired)
+			}
+		})
+	}
+}
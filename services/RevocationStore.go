@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RevocationStore keeps track of access tokens that must not be accepted anymore
+// before their exp. Single tokens are revoked by jti; all tokens of a user are
+// revoked by bumping the user's token generation, which every access token carries.
+type RevocationStore interface {
+	RevokeToken(tokenId string, expiresAt time.Time) error
+	IsTokenRevoked(tokenId string) (bool, error)
+	RevokeUserTokens(userId string) error
+	TokenGeneration(userId string) (int, error)
+}
+
+// === === === === ===
+//
+// === Database store ===
+//
+// === === === === ===
+type DBRevocationStore struct {
+	DB *sqlx.DB
+}
+
+func NewDBRevocationStore(db *sqlx.DB) *DBRevocationStore {
+	return &DBRevocationStore{
+		DB: db,
+	}
+}
+
+func (s *DBRevocationStore) RevokeToken(tokenId string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_tokens (tokenid, expiresat)
+	VALUES ($1, $2)
+	ON CONFLICT (tokenid) DO NOTHING
+	`
+	_, err := s.DB.Exec(query, tokenId, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	// Revoked tokens only matter until they expire on their own
+	_, err = s.DB.Exec(`DELETE FROM revoked_tokens WHERE expiresat < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (s *DBRevocationStore) IsTokenRevoked(tokenId string) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE tokenid = $1)`
+	err := s.DB.Get(&revoked, query, tokenId)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (s *DBRevocationStore) RevokeUserTokens(userId string) error {
+	query := `
+	INSERT INTO token_generations (userid, generation)
+	VALUES ($1, 1)
+	ON CONFLICT (userid) DO UPDATE SET generation = token_generations.generation + 1
+	`
+	_, err := s.DB.Exec(query, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (s *DBRevocationStore) TokenGeneration(userId string) (int, error) {
+	var generation int
+	query := `SELECT COALESCE((SELECT generation FROM token_generations WHERE userid = $1), 0)`
+	err := s.DB.Get(&generation, query, userId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch token generation: %w", err)
+	}
+
+	return generation, nil
+}
+
+// === === === === ===
+//
+// === In-memory store ===
+//
+// === === === === ===
+
+// MemoryRevocationStore keeps revocations in process memory. It suits a single
+// instance or local development; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu          sync.RWMutex
+	tokens      map[string]time.Time
+	generations map[string]int
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:      map[string]time.Time{},
+		generations: map[string]int{},
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(tokenId string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[tokenId] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsTokenRevoked(tokenId string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.tokens[tokenId]
+	return revoked, nil
+}
+
+func (s *MemoryRevocationStore) RevokeUserTokens(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generations[userId]++
+	return nil
+}
+
+func (s *MemoryRevocationStore) TokenGeneration(userId string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.generations[userId], nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"movie/oidc"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SSOLoginTTL is how long a user has to finish logging in at the provider.
+const SSOLoginTTL = 10 * time.Minute
+
+// GroupRole maps a group of the identity provider to one of our roles.
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// SSOService logs users in through an OpenID Connect provider. Provider users
+// are linked to existing accounts by verified email or provisioned on first
+// login, and their role follows their provider groups.
+type SSOService struct {
+	DB       *sqlx.DB
+	Provider *oidc.Provider
+	Tokens   *TokenService
+	MFA      *MFAService
+	// GroupRoles is checked in order, the first group the user is in sets the
+	// role. Without any mappings roles are managed locally only.
+	GroupRoles []GroupRole
+}
+
+// NewSSOService reads the group mappings from OIDC_GROUP_ROLES, e.g.
+// "movie-admins=admin,box-office=box_office". provider is nil when single
+// sign-on isn't configured.
+func NewSSOService(db *sqlx.DB, provider *oidc.Provider, tokenService *TokenService, mfaService *MFAService) *SSOService {
+	var groupRoles []GroupRole
+	for _, mapping := range strings.Split(os.Getenv("OIDC_GROUP_ROLES"), ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(mapping), "=")
+		if ok && group != "" && role != "" {
+			groupRoles = append(groupRoles, GroupRole{Group: group, Role: role})
+		}
+	}
+
+	return &SSOService{
+		DB:         db,
+		Provider:   provider,
+		Tokens:     tokenService,
+		MFA:        mfaService,
+		GroupRoles: groupRoles,
+	}
+}
+
+// BeginLogin starts a login and returns the provider URL to send the browser to,
+// and the state the browser has to come back with. Nonce and PKCE verifier are
+// kept server-side until the callback.
+func (ss *SSOService) BeginLogin() (authURL, state string, err error) {
+	if ss.Provider == nil {
+		return "", "", fmt.Errorf("single sign-on is not configured")
+	}
+
+	state, err = oidc.RandomString()
+	if err != nil {
+		return "", "", fmt.Errorf("error starting sso login: %w", err)
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", fmt.Errorf("error starting sso login: %w", err)
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", fmt.Errorf("error starting sso login: %w", err)
+	}
+
+	authURL, err = ss.Provider.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = ss.DB.Exec(`DELETE FROM oidc_login_states WHERE expiresat < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return "", "", fmt.Errorf("error starting sso login: %w", err)
+	}
+
+	insertQuery := `
+	INSERT INTO oidc_login_states (statehash, nonce, codeverifier, expiresat)
+	VALUES ($1, $2, $3, $4)
+	`
+	_, err = ss.DB.Exec(insertQuery, helpers.HashOpaqueToken(state), nonce, verifier, time.Now().Add(SSOLoginTTL))
+	if err != nil {
+		return "", "", fmt.Errorf("error starting sso login: %w", err)
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteLogin handles the provider's redirect back to us. Like a password
+// login it returns an MFARequiredError when the provider didn't do a second
+// factor but the account has one enabled here.
+func (ss *SSOService) CompleteLogin(code, state string, client models.Client) (*models.User, string, string, error) {
+	if ss.Provider == nil {
+		return nil, "", "", fmt.Errorf("single sign-on is not configured")
+	}
+
+	// States are single-use
+	var login struct {
+		Nonce        string `db:"nonce"`
+		CodeVerifier string `db:"codeverifier"`
+	}
+	stateQuery := `
+	DELETE FROM oidc_login_states
+	WHERE statehash = $1 AND expiresat > CURRENT_TIMESTAMP
+	RETURNING nonce, codeverifier
+	`
+	err := ss.DB.Get(&login, stateQuery, helpers.HashOpaqueToken(state))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid or expired sso login state")
+	}
+
+	claims, err := ss.Provider.Exchange(code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("sso login failed: %w", err)
+	}
+
+	user, err := ss.findOrProvisionUser(claims)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if user.SuspendedAt != nil {
+		return nil, "", "", ErrAccountSuspended
+	}
+
+	if err = ss.syncRole(user, claims.Groups); err != nil {
+		return nil, "", "", err
+	}
+
+	mfa := providerDidMFA(claims)
+	if !mfa {
+		mfaEnabled, err := ss.MFA.IsEnabled(user.UserId.String())
+		if err != nil {
+			return nil, "", "", err
+		}
+		if mfaEnabled {
+			mfaToken, err := helpers.GenerateMFAToken(user.UserId.String())
+			if err != nil {
+				return nil, "", "", fmt.Errorf("error generating mfa token: %w", err)
+			}
+			return nil, "", "", &MFARequiredError{Token: mfaToken}
+		}
+	}
+
+	accessToken, refreshToken, err := ss.Tokens.IssueTokens(user, mfa, client)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return user, accessToken, refreshToken, nil
+}
+
+// findOrProvisionUser returns the account linked to the provider identity. An
+// unlinked identity is linked to the account with the same email only if the
+// provider verified the address; otherwise a new account is created.
+func (ss *SSOService) findOrProvisionUser(claims *oidc.IDClaims) (*models.User, error) {
+	tx, err := ss.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	linkedQuery := `
+	SELECT u.userid, u.name, u.email, u.role, u.verified, u.suspendedat, u.createdat, u.updatedat
+	FROM user_identities i
+	JOIN users u ON u.userid = i.userid
+	WHERE i.issuer = $1 AND i.subject = $2 AND u.deletedat IS NULL
+	`
+	err = tx.Get(&user, linkedQuery, ss.Provider.Issuer, claims.Subject)
+	switch {
+	case err == nil:
+		updateQuery := `
+		UPDATE user_identities SET email = $3, lastloginat = CURRENT_TIMESTAMP
+		WHERE issuer = $1 AND subject = $2
+		`
+		if _, err = tx.Exec(updateQuery, ss.Provider.Issuer, claims.Subject, claims.Email); err != nil {
+			return nil, fmt.Errorf("error updating identity: %w", err)
+		}
+
+	case claims.Email == "":
+		return nil, fmt.Errorf("sso login failed: the provider didn't share an email address")
+
+	default:
+		emailQuery := `
+		SELECT userid, name, email, role, verified, suspendedat, createdat, updatedat
+		FROM users WHERE LOWER(email) = LOWER($1) AND deletedat IS NULL
+		FOR UPDATE
+		`
+		err = tx.Get(&user, emailQuery, claims.Email)
+		switch {
+		case err == nil && !claims.EmailVerified:
+			return nil, fmt.Errorf("sso login failed: the provider hasn't verified %s, which belongs to an existing account", claims.Email)
+		case err == nil:
+			// The provider vouches for the address, so it counts as verified here too
+			_, err = tx.Exec(`UPDATE users SET verified = true, updatedat = CURRENT_TIMESTAMP WHERE userid = $1`, user.UserId)
+			if err != nil {
+				return nil, fmt.Errorf("error linking account: %w", err)
+			}
+			user.Verified = true
+		default:
+			if err = provisionUser(tx, &user, claims); err != nil {
+				return nil, err
+			}
+		}
+
+		linkQuery := `INSERT INTO user_identities (issuer, subject, userid, email, lastloginat) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+		_, err = tx.Exec(linkQuery, ss.Provider.Issuer, claims.Subject, user.UserId, claims.Email)
+		if err != nil {
+			return nil, fmt.Errorf("error linking account: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error linking account: %w", err)
+	}
+
+	return &user, nil
+}
+
+// provisionUser creates the account of a first-time provider user. It has no
+// local password; one can be set through the password reset.
+func provisionUser(tx *sqlx.Tx, user *models.User, claims *oidc.IDClaims) error {
+	if err := helpers.ValidateEmail(claims.Email); err != nil {
+		return fmt.Errorf("sso login failed: %w", err)
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = claims.Email
+	}
+
+	query := `
+	INSERT INTO users (userid, name, email, password, role, verified)
+	VALUES ($1, $2, $3, '', $4, $5)
+	RETURNING userid, name, email, role, verified, createdat, updatedat
+	`
+	err := tx.Get(user, query, uuid.New(), name, claims.Email, models.RoleUser, claims.EmailVerified)
+	if err != nil {
+		return fmt.Errorf("error provisioning user: %w", err)
+	}
+
+	return nil
+}
+
+// syncRole gives the user the role of their provider groups. A changed role
+// revokes the user's existing tokens, like AssignRole does.
+func (ss *SSOService) syncRole(user *models.User, groups []string) error {
+	if len(ss.GroupRoles) == 0 {
+		return nil
+	}
+
+	role := models.RoleUser
+	for _, mapping := range ss.GroupRoles {
+		if slices.Contains(groups, mapping.Group) {
+			role = mapping.Role
+			break
+		}
+	}
+	if role == user.Role {
+		return nil
+	}
+
+	_, err := ss.DB.Exec(`UPDATE users SET role = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2`, role, user.UserId)
+	if err != nil {
+		return fmt.Errorf("error assigning role %s: %w", role, err)
+	}
+	user.Role = role
+
+	return ss.Tokens.LogoutAll(user.UserId.String())
+}
+
+// providerDidMFA reports whether the ID token says the login used more than one
+// factor (RFC 8176 "mfa" authentication method).
+func providerDidMFA(claims *oidc.IDClaims) bool {
+	return slices.Contains(claims.AMR, "mfa")
+}
@@ -0,0 +1,151 @@
+package services_test
+
+import (
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/oidc/oidctest"
+	"movie/services"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ssoLogin runs a whole login as the provider user with the claims.
+func ssoLogin(t *testing.T, ss *services.SSOService, mock *oidctest.Provider, claims jwt.MapClaims) (*models.User, error) {
+	t.Helper()
+
+	authURL, state, err := ss.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+	code, returnedState, err := mock.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("provider refused the auth request: %v", err)
+	}
+	if returnedState != state {
+		t.Fatalf("provider returned state %q, expected %q", returnedState, state)
+	}
+
+	user, _, _, err := ss.CompleteLogin(code, state, models.Client{IP: "127.0.0.1"})
+	return user, err
+}
+
+func TestSSOProvisionsNewUsers(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	ss, mock := testutil.SSOService(t, db)
+
+	email := testutil.Email(t, db)
+	subject := uuid.New().String()
+	claims := jwt.MapClaims{"sub": subject, "email": email, "email_verified": true, "name": "Jane Doe"}
+
+	user, err := ssoLogin(t, ss, mock, claims)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if user.Email != email || user.Name != "Jane Doe" || user.Role != models.RoleUser || !user.Verified {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	again, err := ssoLogin(t, ss, mock, claims)
+	if err != nil {
+		t.Fatalf("second login failed: %v", err)
+	}
+	if again.UserId != user.UserId {
+		t.Errorf("second login got user %s, expected %s", again.UserId, user.UserId)
+	}
+}
+
+func TestSSOLinksAccountsByVerifiedEmail(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	ss, mock := testutil.SSOService(t, db)
+
+	existingId := testutil.User(t, db)
+	var email string
+	if err := db.Get(&email, `SELECT email FROM users WHERE userid = $1`, existingId.String()); err != nil {
+		t.Fatalf("failed to fetch user: %v", err)
+	}
+
+	_, err := ssoLogin(t, ss, mock, jwt.MapClaims{"sub": uuid.New().String(), "email": email, "email_verified": false})
+	if err == nil || !strings.Contains(err.Error(), "hasn't verified") {
+		t.Fatalf("expected an unverified email not to be linked, got %v", err)
+	}
+
+	user, err := ssoLogin(t, ss, mock, jwt.MapClaims{"sub": uuid.New().String(), "email": strings.ToUpper(email), "email_verified": true})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if user.UserId != existingId {
+		t.Errorf("expected the existing account %s, got %s", existingId, user.UserId)
+	}
+}
+
+func TestSSOMapsGroupsToRoles(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	ss, mock := testutil.SSOService(t, db,
+		services.GroupRole{Group: "movie-admins", Role: "admin"},
+		services.GroupRole{Group: "box-office", Role: "box_office"},
+	)
+
+	email := testutil.Email(t, db)
+	subject := uuid.New().String()
+
+	tests := []struct {
+		name   string
+		groups []string
+		role   string
+	}{
+		{"first matching group wins", []string{"staff", "box-office", "movie-admins"}, "admin"},
+		{"single group", []string{"box-office"}, "box_office"},
+		{"no matching group", []string{"staff"}, models.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": subject, "email": email, "email_verified": true, "groups": tt.groups}
+			user, err := ssoLogin(t, ss, mock, claims)
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+
+			var role string
+			if err = db.Get(&role, `SELECT role FROM users WHERE userid = $1`, user.UserId); err != nil {
+				t.Fatalf("failed to fetch role: %v", err)
+			}
+			if user.Role != tt.role || role != tt.role {
+				t.Errorf("expected role %s, got %s (stored %s)", tt.role, user.Role, role)
+			}
+		})
+	}
+}
+
+func TestSSOStatesAreSingleUse(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	ss, mock := testutil.SSOService(t, db)
+
+	email := testutil.Email(t, db)
+	authURL, state, err := ss.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+	code, _, err := mock.Authorize(authURL, jwt.MapClaims{"sub": uuid.New().String(), "email": email, "email_verified": true})
+	if err != nil {
+		t.Fatalf("provider refused the auth request: %v", err)
+	}
+
+	if _, _, _, err = ss.CompleteLogin(code, "forged-state", models.Client{}); err == nil {
+		t.Fatal("expected an unknown state to be rejected")
+	}
+	if _, _, _, err = ss.CompleteLogin(code, state, models.Client{}); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, _, _, err = ss.CompleteLogin(code, state, models.Client{}); err == nil || !strings.Contains(err.Error(), "invalid or expired") {
+		t.Fatalf("expected a used state to be rejected, got %v", err)
+	}
+}
@@ -22,9 +22,33 @@ func NewShowtimeService(db *sqlx.DB) *ShowtimeService {
 func (ss *ShowtimeService) AddShowtimes(showtime *models.Showtime) (*models.Showtime, error) {
 	showtime.ShowtimeId = uuid.New().String()[:10]
 
+	// Showtimes in a mapped auditorium sell exactly the seats of its layout
+	if showtime.AuditoriumId != nil {
+		var auditorium struct {
+			Venue string `db:"venue"`
+			Seats int    `db:"seats"`
+		}
+		auditoriumQuery := `
+		SELECT a.venue, COUNT(s.seatid) FILTER (WHERE NOT s.disabled) AS seats
+		FROM auditoriums a
+		LEFT JOIN seats s ON s.auditoriumid = a.auditoriumid
+		WHERE a.auditoriumid = $1
+		GROUP BY a.auditoriumid
+		`
+		err := ss.DB.Get(&auditorium, auditoriumQuery, *showtime.AuditoriumId)
+		if err != nil {
+			return nil, fmt.Errorf("auditorium not found: %w", err)
+		}
+
+		showtime.AvailableSeats = auditorium.Seats
+		if showtime.Venue == "" {
+			showtime.Venue = auditorium.Venue
+		}
+	}
+
 	query := `
-	INSERT INTO showtimes (showtimeid, movieid, starttime, endtime, venue, priceperseat, availableseats)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	INSERT INTO showtimes (showtimeid, movieid, starttime, endtime, venue, auditoriumid, priceperseat, availableseats)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	RETURNING *
 	`
 	err := ss.DB.Get(showtime, query,
@@ -33,10 +57,9 @@ func (ss *ShowtimeService) AddShowtimes(showtime *models.Showtime) (*models.Show
 		showtime.StartTime,
 		showtime.EndTime,
 		showtime.Venue,
+		showtime.AuditoriumId,
 		showtime.PricePerSeat,
 		showtime.AvailableSeats,
-		showtime.CreatedAt,
-		showtime.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -97,6 +120,16 @@ func (ss *ShowtimeService) UpdateShowtime(Showtime *models.Showtime) (*models.Sh
 	}
 
 	if Showtime.AvailableSeats != 0 {
+		// The seats of an auditorium showtime are counted from its seat map
+		var auditoriumId *string
+		err := ss.DB.Get(&auditoriumId, `SELECT auditoriumid FROM showtimes WHERE showtimeid = $1`, Showtime.ShowtimeId)
+		if err != nil {
+			return nil, fmt.Errorf("showtime not found: %w", err)
+		}
+		if auditoriumId != nil {
+			return nil, fmt.Errorf("availableSeats of a showtime with an auditorium can't be set, it follows the seat map")
+		}
+
 		setClauses = append(setClauses, fmt.Sprintf("availableseats = $%d", argIndex))
 		args = append(args, Showtime.AvailableSeats)
 		argIndex++
@@ -143,7 +176,10 @@ func (ss *ShowtimeService) GetShowtimesAndMovieData(MovieId string) (*[]models.S
 	  s.availableseats,
 	  m.movieid,
 	  m.title,
-	  m.genre,
+	  ARRAY(
+	    SELECT g.name FROM movie_genres mg JOIN genres g ON g.genreid = mg.genreid
+	    WHERE mg.movieid = m.movieid ORDER BY g.name
+	  ) AS genres,
 	  m.director,
 	  m.posterimage
 	FROM showtimes s
@@ -159,21 +195,65 @@ func (ss *ShowtimeService) GetShowtimesAndMovieData(MovieId string) (*[]models.S
 	return &showtimes, nil
 }
 
-func (ss *ShowtimeService) CheckAvailableSeats(MovieId string) (*models.SeatsAndPrice, error) {
-	if MovieId == "" {
-		return nil, fmt.Errorf("need MovieId to check available seats in db")
+func (ss *ShowtimeService) GetSeatMap(showtimeId string) (*models.SeatMap, error) {
+	if showtimeId == "" {
+		return nil, fmt.Errorf("need showtimeId to fetch the seat map")
+	}
+
+	var showtime models.Showtime
+	err := ss.DB.Get(&showtime, `SELECT * FROM showtimes WHERE showtimeid = $1`, showtimeId)
+	if err != nil {
+		return nil, fmt.Errorf("showtime not found: %w", err)
+	}
+
+	seatMap := &models.SeatMap{
+		ShowtimeId:     showtime.ShowtimeId,
+		PricePerSeat:   showtime.PricePerSeat,
+		AvailableSeats: showtime.AvailableSeats,
+		Rows:           []models.SeatRow{},
+	}
+
+	// General admission showtimes only have a seat counter
+	if showtime.AuditoriumId == nil {
+		return seatMap, nil
+	}
+
+	seatMap.AuditoriumId = *showtime.AuditoriumId
+	err = ss.DB.Get(&seatMap.AuditoriumName, `SELECT name FROM auditoriums WHERE auditoriumid = $1`, seatMap.AuditoriumId)
+	if err != nil {
+		return nil, fmt.Errorf("auditorium not found: %w", err)
 	}
-	var seatsAndPriceData models.SeatsAndPrice
 
+	var seats []models.ShowtimeSeat
 	query := `
-	SELECT availableseats, priceperseat
-	FROM showtimes
-	WHERE movieid = $1
+	SELECT s.*,
+	  (
+	    EXISTS (
+	      SELECT 1 FROM reservation_seats rs
+	      WHERE rs.showtimeid = $1 AND rs.seatid = s.seatid AND rs.releasedat IS NULL
+	    ) OR EXISTS (
+	      SELECT 1 FROM seat_hold_seats hs
+	      JOIN seat_holds h ON h.holdid = hs.holdid
+	      WHERE hs.showtimeid = $1 AND hs.seatid = s.seatid AND h.status = 'active'
+	    )
+	  ) AS taken
+	FROM seats s
+	WHERE s.auditoriumid = $2
+	ORDER BY s.rowindex, s.seatnumber
 	`
-	err := ss.DB.Get(&seatsAndPriceData, query, MovieId)
+	err = ss.DB.Select(&seats, query, showtimeId, seatMap.AuditoriumId)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching seats for given movieid: %w", err)
+		return nil, fmt.Errorf("error fetching seats for showtime: %w", err)
+	}
+
+	for _, seat := range seats {
+		last := len(seatMap.Rows) - 1
+		if last < 0 || seatMap.Rows[last].RowLabel != seat.RowLabel {
+			seatMap.Rows = append(seatMap.Rows, models.SeatRow{RowLabel: seat.RowLabel})
+			last++
+		}
+		seatMap.Rows[last].Seats = append(seatMap.Rows[last].Seats, seat)
 	}
 
-	return &seatsAndPriceData, nil
+	return seatMap, nil
 }
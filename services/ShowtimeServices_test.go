@@ -0,0 +1,44 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUpdateShowtimeSeatsOnlyForGeneralAdmission(t *testing.T) {
+	db := testutil.DB(t)
+	ss := services.NewShowtimeService(db)
+
+	showtimeId := testutil.Showtime(t, db, 10)
+	showtime, err := ss.UpdateShowtime(&models.Showtime{ShowtimeId: showtimeId, AvailableSeats: 20})
+	if err != nil {
+		t.Fatalf("failed to update general admission seats: %v", err)
+	}
+	if showtime.AvailableSeats != 20 {
+		t.Errorf("expected 20 seats, got %d", showtime.AvailableSeats)
+	}
+
+	auditoriumId := uuid.New().String()[:10]
+	if _, err = db.Exec(`INSERT INTO auditoriums (auditoriumid, name) VALUES ($1, 'Test Hall')`, auditoriumId); err != nil {
+		t.Fatalf("failed to create auditorium: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM auditoriums WHERE auditoriumid = $1`, auditoriumId) })
+
+	seatedId := testutil.Showtime(t, db, 10)
+	if _, err = db.Exec(`UPDATE showtimes SET auditoriumid = $2 WHERE showtimeid = $1`, seatedId, auditoriumId); err != nil {
+		t.Fatalf("failed to assign auditorium: %v", err)
+	}
+
+	_, err = ss.UpdateShowtime(&models.Showtime{ShowtimeId: seatedId, AvailableSeats: 20})
+	if err == nil || !strings.Contains(err.Error(), "can't be set") {
+		t.Fatalf("expected setting the seats of an auditorium showtime to fail, got %v", err)
+	}
+	if seats := testutil.AvailableSeats(t, db, seatedId); seats != 10 {
+		t.Errorf("expected the seat counter to stay at 10, got %d", seats)
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"fmt"
+	"movie/helpers"
+	"movie/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// TokenService issues access/refresh token pairs. Refresh tokens are tracked
+// server-side in families: every login starts a family and every refresh rotates
+// the token within it. Replaying a rotated-out token revokes the whole family.
+type TokenService struct {
+	DB          *sqlx.DB
+	Revocations RevocationStore
+}
+
+func NewTokenService(db *sqlx.DB, revocations RevocationStore) *TokenService {
+	return &TokenService{
+		DB:          db,
+		Revocations: revocations,
+	}
+}
+
+// IssueTokens starts a new refresh token family for the user and returns the
+// first access/refresh pair of it. mfa tells whether the login passed a second
+// factor; tokens refreshed within the family keep that state.
+func (ts *TokenService) IssueTokens(user *models.User, mfa bool, client models.Client) (string, string, error) {
+	familyId := uuid.New().String()
+
+	tx, err := ts.DB.Beginx()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	familyQuery := `
+	INSERT INTO refresh_token_families (familyid, userid, mfa, useragent, ipaddress)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.Exec(familyQuery, familyId, user.UserId, mfa, truncate(client.UserAgent, maxUserAgentLength), client.IP)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token family: %w", err)
+	}
+
+	accessToken, refreshToken, err := ts.issuePair(tx, user, familyId, mfa)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// Refresh exchanges a valid refresh token for a new access/refresh pair of the
+// same family. The presented token can't be used again afterwards.
+func (ts *TokenService) Refresh(refreshToken string, client models.Client) (*models.User, string, string, error) {
+	tokenId, familyId, _, err := helpers.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	tx, err := ts.DB.Beginx()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var family struct {
+		UserId    string     `db:"userid"`
+		Mfa       bool       `db:"mfa"`
+		RevokedAt *time.Time `db:"revokedat"`
+	}
+	familyQuery := `SELECT userid, mfa, revokedat FROM refresh_token_families WHERE familyid = $1 FOR UPDATE`
+	err = tx.Get(&family, familyQuery, familyId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid refresh token: unknown token family")
+	}
+	if family.RevokedAt != nil {
+		return nil, "", "", fmt.Errorf("invalid refresh token: token has been revoked")
+	}
+
+	var stored struct {
+		ExpiresAt time.Time  `db:"expiresat"`
+		RotatedAt *time.Time `db:"rotatedat"`
+	}
+	tokenQuery := `SELECT expiresat, rotatedat FROM refresh_tokens WHERE tokenid = $1 AND familyid = $2`
+	err = tx.Get(&stored, tokenQuery, tokenId, familyId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid refresh token: unknown token")
+	}
+
+	// A rotated-out token showing up again means it was stolen, so nobody in
+	// this family gets a new token anymore
+	if stored.RotatedAt != nil {
+		err = revokeFamily(tx, familyId)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, "", "", fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err = ts.revokeSessionTokens(familyId); err != nil {
+			return nil, "", "", err
+		}
+		return nil, "", "", fmt.Errorf("invalid refresh token: reuse detected, all sessions of this login were revoked")
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, "", "", fmt.Errorf("invalid refresh token: token has expired")
+	}
+
+	rotateQuery := `UPDATE refresh_tokens SET rotatedat = CURRENT_TIMESTAMP WHERE tokenid = $1`
+	_, err = tx.Exec(rotateQuery, tokenId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	seenQuery := `
+	UPDATE refresh_token_families
+	SET lastseenat = CURRENT_TIMESTAMP, ipaddress = $2, useragent = $3
+	WHERE familyid = $1
+	`
+	_, err = tx.Exec(seenQuery, familyId, client.IP, truncate(client.UserAgent, maxUserAgentLength))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to update session: %w", err)
+	}
+
+	// Claims are rebuilt from the current user row, not copied from the old token
+	var user models.User
+	userQuery := `
+	SELECT userid, name, email, role, verified, createdat, updatedat FROM users
+	WHERE userid = $1 AND suspendedat IS NULL AND deletedat IS NULL
+	`
+	err = tx.Get(&user, userQuery, family.UserId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid refresh token: account is not active")
+	}
+
+	accessToken, newRefreshToken, err := ts.issuePair(tx, &user, familyId, family.Mfa)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return &user, accessToken, newRefreshToken, nil
+}
+
+// Logout revokes the access token in use and the session it belongs to. Tokens
+// issued before sessions were named in access tokens fall back to the refresh
+// token, refresh tokens of other users are ignored.
+func (ts *TokenService) Logout(userId, tokenId, sessionId string, expiresAt time.Time, refreshToken string) error {
+	err := ts.Revocations.RevokeToken(tokenId, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if sessionId == "" && refreshToken != "" {
+		_, familyId, refreshUserId, err := helpers.ParseRefreshToken(refreshToken)
+		if err == nil && refreshUserId == userId {
+			sessionId = familyId
+		}
+	}
+	if sessionId == "" {
+		return nil
+	}
+
+	err = ts.RevokeSession(userId, sessionId)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+
+	return nil
+}
+
+// GetSessions lists the user's sessions that can still be refreshed, most
+// recently used first. currentSessionId marks the session of the request.
+func (ts *TokenService) GetSessions(userId, currentSessionId string) ([]models.Session, error) {
+	sessions := []models.Session{}
+	query := `
+	SELECT f.familyid, f.useragent, f.ipaddress, f.mfa, f.createdat, f.lastseenat, f.revokedat
+	FROM refresh_token_families f
+	WHERE f.userid = $1 AND f.revokedat IS NULL AND EXISTS (
+	  SELECT 1 FROM refresh_tokens t
+	  WHERE t.familyid = f.familyid AND t.rotatedat IS NULL AND t.expiresat > CURRENT_TIMESTAMP
+	)
+	ORDER BY f.lastseenat DESC
+	`
+	err := ts.DB.Select(&sessions, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sessions: %w", err)
+	}
+
+	for i := range sessions {
+		sessions[i].Device = helpers.DescribeDevice(sessions[i].UserAgent)
+		sessions[i].Current = sessions[i].SessionId == currentSessionId
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs one session of the user out: its refresh tokens stop
+// working and so do the access tokens issued within it.
+func (ts *TokenService) RevokeSession(userId, sessionId string) error {
+	query := `
+	UPDATE refresh_token_families
+	SET revokedat = CURRENT_TIMESTAMP
+	WHERE familyid = $1 AND userid = $2 AND revokedat IS NULL
+	`
+	result, err := ts.DB.Exec(query, sessionId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if revoked == 0 {
+		return fmt.Errorf("session not found or already revoked")
+	}
+
+	return ts.revokeSessionTokens(sessionId)
+}
+
+// revokeSessionTokens revokes the access tokens of a session. They carry the
+// session id in "sid", which is checked like a token id and needs to be kept
+// only as long as access tokens live.
+func (ts *TokenService) revokeSessionTokens(sessionId string) error {
+	return ts.Revocations.RevokeToken(sessionId, time.Now().Add(helpers.AccessTokenTTL))
+}
+
+// LogoutAll revokes every access and refresh token of the user.
+func (ts *TokenService) LogoutAll(userId string) error {
+	err := ts.Revocations.RevokeUserTokens(userId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE refresh_token_families
+	SET revokedat = CURRENT_TIMESTAMP
+	WHERE userid = $1 AND revokedat IS NULL
+	`
+	_, err = ts.DB.Exec(query, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token families: %w", err)
+	}
+
+	return nil
+}
+
+// issuePair stores a new refresh token of the family and signs both tokens.
+func (ts *TokenService) issuePair(tx *sqlx.Tx, user *models.User, familyId string, mfa bool) (string, string, error) {
+	tokenId := uuid.New().String()
+	expiresAt := time.Now().Add(helpers.RefreshTokenTTL)
+
+	tokenQuery := `INSERT INTO refresh_tokens (tokenid, familyid, expiresat) VALUES ($1, $2, $3)`
+	_, err := tx.Exec(tokenQuery, tokenId, familyId, expiresAt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	generation, err := ts.Revocations.TokenGeneration(user.UserId.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := helpers.GenerateAccessToken(user.UserId.String(), user.Email, user.Role, familyId, generation, mfa)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating access token: %w", err)
+	}
+
+	refreshToken, err := helpers.GenerateRefreshToken(user.UserId.String(), user.Email, user.Role, tokenId, familyId, expiresAt)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func revokeFamily(tx *sqlx.Tx, familyId string) error {
+	query := `
+	UPDATE refresh_token_families
+	SET revokedat = CURRENT_TIMESTAMP
+	WHERE familyid = $1 AND revokedat IS NULL
+	`
+	_, err := tx.Exec(query, familyId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// maxUserAgentLength caps what is stored of a client's User-Agent header.
+const maxUserAgentLength = 512
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
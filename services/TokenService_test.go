@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"movie/helpers"
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSessionsCanBeListedAndRevoked(t *testing.T) {
+	db := testutil.DB(t)
+	testutil.Keyrings(t, helpers.UseKeyrings)
+	store := services.NewMemoryRevocationStore()
+	ts := services.NewTokenService(db, store)
+
+	user := &models.User{UserId: testutil.User(t, db), Email: "user@example.com", Role: "user"}
+	otherUserId := testutil.User(t, db).String()
+
+	// A User-Agent longer than what is stored, cut in the middle of a character
+	longAgent := "Mozilla/5.0 (Windows NT 10.0) Firefox/128.0" + strings.Repeat("ü", 300)
+	clients := []models.Client{
+		{IP: "192.0.2.1", UserAgent: longAgent},
+		{IP: "192.0.2.2", UserAgent: "curl/8.7.1"},
+	}
+	var sessionIds []string
+	for _, client := range clients {
+		accessToken, _, err := ts.IssueTokens(user, false, client)
+		if err != nil {
+			t.Fatalf("failed to issue tokens: %v", err)
+		}
+		claims, err := helpers.ParseAccessToken(accessToken)
+		if err != nil {
+			t.Fatalf("failed to parse access token: %v", err)
+		}
+		sessionIds = append(sessionIds, claims.SessionId)
+	}
+
+	sessions, err := ts.GetSessions(user.UserId.String(), sessionIds[0])
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.SessionId == sessionIds[0]) {
+			t.Errorf("session %s: current = %v", session.SessionId, session.Current)
+		}
+		if !utf8.ValidString(session.UserAgent) || len(session.UserAgent) > 512 {
+			t.Errorf("session %s: stored user agent is invalid or too long: %d bytes", session.SessionId, len(session.UserAgent))
+		}
+		if session.SessionId == sessionIds[0] && session.Device != "Firefox on Windows" {
+			t.Errorf("expected Firefox on Windows, got %q", session.Device)
+		}
+	}
+
+	err = ts.RevokeSession(otherUserId, sessionIds[1])
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected revoking another user's session to fail, got %v", err)
+	}
+	if revoked, _ := store.IsTokenRevoked(sessionIds[1]); revoked {
+		t.Error("expected the session's access tokens to stay valid")
+	}
+
+	if err = ts.RevokeSession(user.UserId.String(), sessionIds[1]); err != nil {
+		t.Fatalf("failed to revoke session: %v", err)
+	}
+	if revoked, _ := store.IsTokenRevoked(sessionIds[1]); !revoked {
+		t.Error("expected the session's access tokens to be revoked")
+	}
+	if err = ts.RevokeSession(user.UserId.String(), sessionIds[1]); err == nil {
+		t.Error("expected revoking a session twice to fail")
+	}
+
+	sessions, err = ts.GetSessions(user.UserId.String(), sessionIds[0])
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionId != sessionIds[0] {
+		t.Errorf("expected only the first session to be left, got %+v", sessions)
+	}
+}
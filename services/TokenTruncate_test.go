@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsCharactersWhole(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Firefox", 10, "Firefox"},
+		{"Firefox", 7, "Firefox"},
+		{"Firefox", 4, "Fire"},
+		{"Gerät", 4, "Ger"}, // ä takes bytes 3 and 4
+		{"Gerät", 5, "Gerä"},
+		{"日本", 2, ""},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.n)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -1,55 +1,119 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"movie/helpers"
+	"movie/mailer"
 	"movie/models"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+const (
+	passwordResetTTL     = 30 * time.Minute
+	emailVerificationTTL = 24 * time.Hour
+	maxNameLength        = 100
+)
+
+// ErrAccountSuspended is returned by logins, password or single sign-on, of a
+// suspended account.
+var ErrAccountSuspended = errors.New("account is suspended")
+
 type UserService struct {
-	DB *sqlx.DB
+	DB       *sqlx.DB
+	Tokens   *TokenService
+	MFA      *MFAService
+	Attempts *LoginAttemptService
+	Mailer   mailer.Mailer
 }
 
-func NewuserService(db *sqlx.DB) *UserService {
+func NewuserService(db *sqlx.DB, tokenService *TokenService, mfaService *MFAService, attempts *LoginAttemptService, mailer mailer.Mailer) *UserService {
 	return &UserService{
-		DB: db,
+		DB:       db,
+		Tokens:   tokenService,
+		MFA:      mfaService,
+		Attempts: attempts,
+		Mailer:   mailer,
 	}
 }
 
-func (us *UserService) Login(creds *models.Credentials) (*models.User, string, string, error) {
+// Login checks the credentials of a login attempt from ip. Unknown accounts and
+// wrong passwords get the same error so logins can't be used to probe for
+// accounts, and repeated failures lock the account and the IP for a while.
+func (us *UserService) Login(creds *models.Credentials, client models.Client) (*models.User, string, string, error) {
+	lockedFor, err := us.Attempts.LockedFor(AccountKey(creds.Email), IPKey(client.IP))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if lockedFor > 0 {
+		return nil, "", "", fmt.Errorf("too many failed login attempts, try again in %s", lockedFor.Round(time.Second))
+	}
+
 	var user models.User
 	query := `
-	SELECT userid, name, email, password, role FROM users WHERE email = $1
+	SELECT userid, name, email, password, role, verified, suspendedat
+	FROM users WHERE email = $1 AND deletedat IS NULL
 	`
 	// Get User
-	err := us.DB.Get(&user, query, creds.Email)
+	err = us.DB.Get(&user, query, creds.Email)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to fetch user: %w", err)
+		helpers.CheckDummyPassword(creds.Password)
 	}
 
 	// Compare passwords
-	ok := !helpers.CheckPasswords(user.Password, creds.Password)
-	if !ok {
-		return nil, "", "", fmt.Errorf("passwords don't match")
+	if err != nil || !helpers.CheckPasswords(creds.Password, user.Password) {
+		if err := us.Attempts.RecordFailures(creds.Email, client.IP); err != nil {
+			return nil, "", "", err
+		}
+		return nil, "", "", fmt.Errorf("invalid email or password")
+	}
+
+	if err = us.Attempts.Reset(AccountKey(creds.Email)); err != nil {
+		return nil, "", "", err
+	}
+
+	if user.SuspendedAt != nil {
+		return nil, "", "", ErrAccountSuspended
 	}
+	user.Password = ""
 
-	accessToken, err := helpers.GenerateAccessToken(user.UserId.String(), user.Email, user.Role)
+	// Too many wrong two-factor codes lock the account even with the right password
+	lockedFor, err = us.Attempts.LockedFor(MFAKey(user.UserId.String()))
 	if err != nil {
-		return nil, "", "", fmt.Errorf("error generating access token: %w", err)
+		return nil, "", "", err
+	}
+	if lockedFor > 0 {
+		return nil, "", "", fmt.Errorf("too many failed login attempts, try again in %s", lockedFor.Round(time.Second))
+	}
+
+	// Accounts with two-factor authentication only get an mfa pending token here
+	mfaEnabled, err := us.MFA.IsEnabled(user.UserId.String())
+	if err != nil {
+		return nil, "", "", err
+	}
+	if mfaEnabled {
+		mfaToken, err := helpers.GenerateMFAToken(user.UserId.String())
+		if err != nil {
+			return nil, "", "", fmt.Errorf("error generating mfa token: %w", err)
+		}
+		return nil, "", "", &MFARequiredError{Token: mfaToken}
 	}
 
-	refreshToken, err := helpers.GenerateRefreshToken(user.UserId.String(), user.Email, user.Role)
+	accessToken, refreshToken, err := us.Tokens.IssueTokens(&user, false, client)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("error generating refresh Token: %w", err)
+		return nil, "", "", err
 	}
 
 	return &user, accessToken, refreshToken, nil
 }
 
-func (us *UserService) Signup(user *models.User) (*models.User, string, string, error) {
+func (us *UserService) Signup(user *models.User, client models.Client) (*models.User, string, string, error) {
 	// checks if entered email is used
 	emailAvailable, err := helpers.IsEmailAvailable(us.DB, user.Email)
 	if err != nil {
@@ -59,10 +123,17 @@ func (us *UserService) Signup(user *models.User) (*models.User, string, string,
 		return nil, "", "", fmt.Errorf("email already taken")
 	}
 
+	if user.DateOfBirth != nil {
+		if err = helpers.ValidateDateOfBirth(*user.DateOfBirth); err != nil {
+			return nil, "", "", err
+		}
+	}
+
 	// generate new userId format: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
 	user.UserId = uuid.New()
 
 	user.Role = "user" // default is user, only admin can promote
+	user.Verified = false
 
 	hashedPassword, err := helpers.HashPassword(user.Password)
 	if err != nil {
@@ -73,30 +144,43 @@ func (us *UserService) Signup(user *models.User) (*models.User, string, string,
 
 	// Insert into DB and return inserted user
 	query := `
-		INSERT INTO users (userid, name, email, password, role)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING userid, name, email, password, role, createdat, updatedat
+		INSERT INTO users (userid, name, email, password, role, dateofbirth)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING userid, name, email, password, role, verified, dateofbirth, createdat, updatedat
 	`
-	err = us.DB.QueryRow(query, user.UserId, user.Name, user.Email, user.Password, user.Role).
-		Scan(&user.UserId, &user.Name, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	err = us.DB.QueryRow(query, user.UserId, user.Name, user.Email, user.Password, user.Role, user.DateOfBirth).
+		Scan(&user.UserId, &user.Name, &user.Email, &user.Password, &user.Role, &user.Verified, &user.DateOfBirth, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("error inserting user: %w", err)
 	}
 
-	// Generate tokens
-	accessToken, err := helpers.GenerateAccessToken(user.UserId.String(), user.Email, user.Role)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("error generating access token: %w", err)
+	// New accounts can log in but not book until the address is confirmed
+	if err = us.sendVerification(user.UserId.String(), user.Email); err != nil {
+		log.Println("Failed to send verification mail:", err)
 	}
+	user.Password = ""
 
-	refreshToken, err := helpers.GenerateRefreshToken(user.UserId.String(), user.Email, user.Role)
+	// Generate tokens
+	accessToken, refreshToken, err := us.Tokens.IssueTokens(user, false, client)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("error generating refresh token: %w", err)
+		return nil, "", "", err
 	}
 
 	return user, accessToken, refreshToken, nil
 }
 
+func (us *UserService) Refresh(refreshToken string, client models.Client) (*models.User, string, string, error) {
+	return us.Tokens.Refresh(refreshToken, client)
+}
+
+func (us *UserService) Logout(userId, tokenId, sessionId string, expiresAt time.Time, refreshToken string) error {
+	return us.Tokens.Logout(userId, tokenId, sessionId, expiresAt, refreshToken)
+}
+
+func (us *UserService) LogoutAll(userId string) error {
+	return us.Tokens.LogoutAll(userId)
+}
+
 func (us *UserService) PromoteToAdmin(userId string) error {
 	var currentRole string
 	checkQuery := `SELECT role FROM users WHERE userid = $1`
@@ -121,3 +205,707 @@ func (us *UserService) PromoteToAdmin(userId string) error {
 
 	return nil
 }
+
+// RequestPasswordReset mails a single-use reset link to the address. It reports
+// success for unknown addresses too, so it can't be used to probe for accounts.
+func (us *UserService) RequestPasswordReset(email string) error {
+	var userId string
+	err := us.DB.Get(&userId, `SELECT userid FROM users WHERE email = $1`, email)
+	if err != nil {
+		return nil
+	}
+
+	token, tokenHash, err := helpers.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error generating reset token: %w", err)
+	}
+
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the newest link works
+	invalidateQuery := `UPDATE password_resets SET usedat = CURRENT_TIMESTAMP WHERE userid = $1 AND usedat IS NULL`
+	_, err = tx.Exec(invalidateQuery, userId)
+	if err != nil {
+		return fmt.Errorf("error storing reset token: %w", err)
+	}
+
+	insertQuery := `INSERT INTO password_resets (tokenhash, userid, expiresat) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(insertQuery, tokenHash, userId, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return fmt.Errorf("error storing reset token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error storing reset token: %w", err)
+	}
+
+	err = us.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %d minutes.\n\n%s/reset-password?token=%s",
+			int(passwordResetTTL.Minutes()), os.Getenv("APP_BASE_URL"), token),
+	})
+	if err != nil {
+		log.Println("Failed to send password reset mail:", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and ends every existing
+// session of the user.
+func (us *UserService) ResetPassword(token, newPassword string) error {
+	if err := helpers.ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := helpers.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userId string
+	fetchQuery := `
+	SELECT userid FROM password_resets
+	WHERE tokenhash = $1 AND usedat IS NULL AND expiresat > CURRENT_TIMESTAMP
+	FOR UPDATE
+	`
+	err = tx.Get(&userId, fetchQuery, helpers.HashOpaqueToken(token))
+	if err != nil {
+		return fmt.Errorf("invalid or expired reset token")
+	}
+
+	_, err = tx.Exec(`UPDATE password_resets SET usedat = CURRENT_TIMESTAMP WHERE tokenhash = $1`, helpers.HashOpaqueToken(token))
+	if err != nil {
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE users SET password = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2`, hashedPassword, userId)
+	if err != nil {
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	return us.Tokens.LogoutAll(userId)
+}
+
+// sendVerification mails a fresh verification link, invalidating older ones.
+func (us *UserService) sendVerification(userId, email string) error {
+	token, tokenHash, err := helpers.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error generating verification token: %w", err)
+	}
+
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	invalidateQuery := `UPDATE email_verifications SET usedat = CURRENT_TIMESTAMP WHERE userid = $1 AND usedat IS NULL`
+	_, err = tx.Exec(invalidateQuery, userId)
+	if err != nil {
+		return fmt.Errorf("error storing verification token: %w", err)
+	}
+
+	insertQuery := `INSERT INTO email_verifications (tokenhash, userid, expiresat) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(insertQuery, tokenHash, userId, time.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return fmt.Errorf("error storing verification token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error storing verification token: %w", err)
+	}
+
+	return us.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Confirm your email address to start booking seats. The link expires in %d hours.\n\n%s/verify-email?token=%s",
+			int(emailVerificationTTL.Hours()), os.Getenv("APP_BASE_URL"), token),
+	})
+}
+
+// ResendVerification mails a new verification link to an unverified account.
+// Like RequestPasswordReset it doesn't reveal whether the address exists.
+func (us *UserService) ResendVerification(email string) error {
+	var user models.User
+	err := us.DB.Get(&user, `SELECT userid, email, verified FROM users WHERE email = $1`, email)
+	if err != nil || user.Verified {
+		return nil
+	}
+
+	if err = us.sendVerification(user.UserId.String(), user.Email); err != nil {
+		log.Println("Failed to send verification mail:", err)
+	}
+
+	return nil
+}
+
+func (us *UserService) VerifyEmail(token string) error {
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userId string
+	fetchQuery := `
+	UPDATE email_verifications
+	SET usedat = CURRENT_TIMESTAMP
+	WHERE tokenhash = $1 AND usedat IS NULL AND expiresat > CURRENT_TIMESTAMP
+	RETURNING userid
+	`
+	err = tx.Get(&userId, fetchQuery, helpers.HashOpaqueToken(token))
+	if err != nil {
+		return fmt.Errorf("invalid or expired verification token")
+	}
+
+	_, err = tx.Exec(`UPDATE users SET verified = true, updatedat = CURRENT_TIMESTAMP WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+
+	return nil
+}
+
+// MarkVerified lets an admin verify an account without the emailed link.
+func (us *UserService) MarkVerified(userId string) error {
+	result, err := us.DB.Exec(`UPDATE users SET verified = true, updatedat = CURRENT_TIMESTAMP WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("error verifying user: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error verifying user: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	_, err = us.DB.Exec(`UPDATE email_verifications SET usedat = CURRENT_TIMESTAMP WHERE userid = $1 AND usedat IS NULL`, userId)
+	if err != nil {
+		return fmt.Errorf("error verifying user: %w", err)
+	}
+
+	return nil
+}
+
+// UnlockAccount clears the failed logins of a user and, when given, of an IP.
+func (us *UserService) UnlockAccount(userId, ip string) error {
+	var email string
+	err := us.DB.Get(&email, `SELECT email FROM users WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if err = us.Attempts.Reset(AccountKey(email)); err != nil {
+		return err
+	}
+
+	if err = us.Attempts.Reset(MFAKey(userId)); err != nil {
+		return err
+	}
+
+	if ip != "" {
+		return us.Attempts.Reset(IPKey(ip))
+	}
+
+	return nil
+}
+
+// AssignRole gives the user another role. Tokens carry the role, so all of the
+// user's tokens are revoked and the new role applies from the next login.
+func (us *UserService) AssignRole(userId, role string) error {
+	var exists bool
+	err := us.DB.Get(&exists, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, role)
+	if err != nil {
+		return fmt.Errorf("error checking role: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("role %s not found", role)
+	}
+
+	result, err := us.DB.Exec(`UPDATE users SET role = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2`, role, userId)
+	if err != nil {
+		return fmt.Errorf("error assigning role: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error assigning role: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return us.Tokens.LogoutAll(userId)
+}
+
+// GetProfile returns the user's own account without the password hash.
+func (us *UserService) GetProfile(userId string) (*models.User, error) {
+	var user models.User
+	query := `
+	SELECT userid, name, email, role, verified, dateofbirth, createdat, updatedat
+	FROM users WHERE userid = $1 AND deletedat IS NULL
+	`
+	err := us.DB.Get(&user, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UpdateProfile applies the fields set in update. Either all of them are
+// applied or, if one is refused, none.
+func (us *UserService) UpdateProfile(userId string, update *models.ProfileUpdate) (*models.User, error) {
+	var name string
+	if update.Name != nil {
+		name = strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, fmt.Errorf("name must not be empty")
+		}
+		if len(name) > maxNameLength {
+			return nil, fmt.Errorf("name must be at most %d characters long", maxNameLength)
+		}
+	}
+	if update.DateOfBirth != nil {
+		if err := helpers.ValidateDateOfBirth(*update.DateOfBirth); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if update.DateOfBirth != nil {
+		// Customers could otherwise make themselves older for age-restricted films
+		query := `
+		UPDATE users SET dateofbirth = $1, updatedat = CURRENT_TIMESTAMP
+		WHERE userid = $2 AND deletedat IS NULL AND dateofbirth IS NULL
+		`
+		result, err := tx.Exec(query, *update.DateOfBirth, userId)
+		if err != nil {
+			return nil, fmt.Errorf("error updating profile: %w", err)
+		}
+		if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+			return nil, fmt.Errorf("date of birth is already set, ask staff to correct it")
+		}
+	}
+
+	if update.Name != nil {
+		query := `UPDATE users SET name = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2 AND deletedat IS NULL`
+		_, err = tx.Exec(query, name, userId)
+		if err != nil {
+			return nil, fmt.Errorf("error updating profile: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error updating profile: %w", err)
+	}
+
+	return us.GetProfile(userId)
+}
+
+// ChangePassword sets a new password after checking the current one. Every other
+// session is ended; the caller gets a fresh token pair to stay logged in.
+func (us *UserService) ChangePassword(userId string, change *models.PasswordChange, mfa bool, client models.Client) (*models.User, string, string, error) {
+	if err := helpers.ValidatePassword(change.NewPassword); err != nil {
+		return nil, "", "", err
+	}
+
+	if err := helpers.CheckCurrentPassword(us.DB, userId, change.CurrentPassword); err != nil {
+		return nil, "", "", err
+	}
+
+	hashedPassword, err := helpers.HashPassword(change.NewPassword)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("could not hash password: %w", err)
+	}
+
+	_, err = us.DB.Exec(`UPDATE users SET password = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2`, hashedPassword, userId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error changing password: %w", err)
+	}
+
+	return us.reissueTokens(userId, mfa, client)
+}
+
+// ChangeEmail moves the account to a new address after checking the current
+// password. The account is unverified until the new address is confirmed, and
+// tokens carrying the old address are replaced.
+func (us *UserService) ChangeEmail(userId string, change *models.EmailChange, mfa bool, client models.Client) (*models.User, string, string, error) {
+	newEmail := strings.TrimSpace(change.NewEmail)
+	if err := helpers.ValidateEmail(newEmail); err != nil {
+		return nil, "", "", err
+	}
+
+	if err := helpers.CheckCurrentPassword(us.DB, userId, change.CurrentPassword); err != nil {
+		return nil, "", "", err
+	}
+
+	var oldEmail string
+	err := us.DB.Get(&oldEmail, `SELECT email FROM users WHERE userid = $1`, userId)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("user not found: %w", err)
+	}
+	if strings.EqualFold(oldEmail, newEmail) {
+		return nil, "", "", fmt.Errorf("new email is the same as the current one")
+	}
+
+	emailAvailable, err := helpers.IsEmailAvailable(us.DB, newEmail)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("could not check email availability: %w", err)
+	}
+	if !emailAvailable {
+		return nil, "", "", fmt.Errorf("email already taken")
+	}
+
+	query := `
+	UPDATE users
+	SET email = $1, verified = false, updatedat = CURRENT_TIMESTAMP
+	WHERE userid = $2
+	`
+	_, err = us.DB.Exec(query, newEmail, userId)
+	if err != nil {
+		// The unique constraint catches addresses taken in the meantime
+		return nil, "", "", fmt.Errorf("error changing email: %w", err)
+	}
+
+	if err = us.sendVerification(userId, newEmail); err != nil {
+		log.Println("Failed to send verification mail:", err)
+	}
+
+	err = us.Mailer.Send(mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body:    fmt.Sprintf("The email address of your account was changed to %s. If this wasn't you, reset your password right away.", newEmail),
+	})
+	if err != nil {
+		log.Println("Failed to send email change notice:", err)
+	}
+
+	return us.reissueTokens(userId, mfa, client)
+}
+
+// reissueTokens revokes every token of the user and starts a new session built
+// from the current user row. mfa carries over the second factor of the session
+// that asked for it.
+func (us *UserService) reissueTokens(userId string, mfa bool, client models.Client) (*models.User, string, string, error) {
+	if err := us.Tokens.LogoutAll(userId); err != nil {
+		return nil, "", "", err
+	}
+
+	user, err := us.GetProfile(userId)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	accessToken, refreshToken, err := us.Tokens.IssueTokens(user, mfa, client)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return user, accessToken, refreshToken, nil
+}
+
+// IsActive reports whether the user exists and is neither suspended nor deleted.
+func (us *UserService) IsActive(userId string) (bool, error) {
+	var active bool
+	query := `
+	SELECT EXISTS (
+	  SELECT 1 FROM users
+	  WHERE userid = $1 AND suspendedat IS NULL AND deletedat IS NULL
+	)
+	`
+	err := us.DB.Get(&active, query, userId)
+	if err != nil {
+		return false, fmt.Errorf("error checking account status: %w", err)
+	}
+
+	return active, nil
+}
+
+// GetUsers lists users page by page, newest first. search matches name or email.
+func (us *UserService) GetUsers(search string, page, pageSize int, includeDeleted bool) (*models.UserPage, error) {
+	where := `WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')`
+	search = helpers.EscapeLike(search)
+	if !includeDeleted {
+		where += ` AND deletedat IS NULL`
+	}
+
+	result := &models.UserPage{
+		Users:      []models.User{},
+		Pagination: models.Pagination{Page: page, PageSize: pageSize},
+	}
+
+	err := us.DB.Get(&result.Total, `SELECT COUNT(*) FROM users `+where, search)
+	if err != nil {
+		return nil, fmt.Errorf("error counting users: %w", err)
+	}
+
+	query := `
+	SELECT userid, name, email, role, verified, dateofbirth, suspendedat, suspensionreason, deletedat, createdat, updatedat
+	FROM users ` + where + `
+	ORDER BY createdat DESC
+	LIMIT $2 OFFSET $3
+	`
+	err = us.DB.Select(&result.Users, query, search, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+
+	return result, nil
+}
+
+// SetDateOfBirth corrects the date of birth of a user, e.g. after staff saw an ID.
+func (us *UserService) SetDateOfBirth(userId string, birthDate time.Time) error {
+	if err := helpers.ValidateDateOfBirth(birthDate); err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET dateofbirth = $1, updatedat = CURRENT_TIMESTAMP WHERE userid = $2 AND deletedat IS NULL`
+	result, err := us.DB.Exec(query, birthDate, userId)
+	if err != nil {
+		return fmt.Errorf("error setting date of birth: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting date of birth: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// Demote turns a staff account back into a regular user.
+func (us *UserService) Demote(userId string) error {
+	var currentRole string
+	err := us.DB.Get(&currentRole, `SELECT role FROM users WHERE userid = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("user not found or error checking user: %w", err)
+	}
+
+	if currentRole == models.RoleUser {
+		return fmt.Errorf("user is already a regular user")
+	}
+
+	return us.AssignRole(userId, models.RoleUser)
+}
+
+// Suspend blocks an account: its tokens stop working immediately and it can't log in.
+// Admins can't suspend themselves or users whose role holds permissions they lack
+// (adminHolds).
+func (us *UserService) Suspend(userId, reason, adminId string, adminHolds func(permission string) bool) error {
+	if err := checkAdminTarget(us.DB, userId, adminId, adminHolds); err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE users
+	SET suspendedat = CURRENT_TIMESTAMP, suspensionreason = NULLIF($2, ''), updatedat = CURRENT_TIMESTAMP
+	WHERE userid = $1 AND deletedat IS NULL
+	`
+	result, err := us.DB.Exec(query, userId, reason)
+	if err != nil {
+		return fmt.Errorf("error suspending user: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error suspending user: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return us.Tokens.LogoutAll(userId)
+}
+
+func (us *UserService) Unsuspend(userId string) error {
+	query := `
+	UPDATE users
+	SET suspendedat = NULL, suspensionreason = NULL, updatedat = CURRENT_TIMESTAMP
+	WHERE userid = $1 AND deletedat IS NULL
+	`
+	result, err := us.DB.Exec(query, userId)
+	if err != nil {
+		return fmt.Errorf("error unsuspending user: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error unsuspending user: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// DeleteUser removes an account. Both modes cancel the user's upcoming
+// reservations and release held seats, bypassing the cancellation cutoff.
+//
+// A soft delete keeps the row (and all past reservations) but blocks the account.
+// A hard delete removes the row together with its cancelled and upcoming
+// reservations, and is refused while past reservations exist, since those are
+// accounting records.
+//
+// Like Suspend, admins can't delete themselves or users with permissions they
+// lack.
+func (us *UserService) DeleteUser(userId string, hard bool, adminId string, adminHolds func(permission string) bool) error {
+	if err := checkAdminTarget(us.DB, userId, adminId, adminHolds); err != nil {
+		return err
+	}
+
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM users WHERE userid = $1 FOR UPDATE)`, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("user not found")
+	}
+
+	if hard {
+		var past int
+		pastQuery := `
+		SELECT COUNT(*) FROM reservations
+		WHERE userid = $1 AND status = 'confirmed' AND reservationdate <= CURRENT_TIMESTAMP
+		`
+		err = tx.Get(&past, pastQuery, userId)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if past > 0 {
+			return fmt.Errorf("user has %d past reservations that must be kept, use a soft delete", past)
+		}
+	}
+
+	if err = releaseUserBookings(tx, userId); err != nil {
+		return err
+	}
+
+	if hard {
+		for _, query := range []string{
+			`DELETE FROM reservations WHERE userid = $1`,
+			`DELETE FROM seat_holds WHERE userid = $1`,
+			`DELETE FROM users WHERE userid = $1`,
+		} {
+			if _, err = tx.Exec(query, userId); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+		}
+	} else {
+		query := `UPDATE users SET deletedat = CURRENT_TIMESTAMP, updatedat = CURRENT_TIMESTAMP WHERE userid = $1`
+		if _, err = tx.Exec(query, userId); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	// Tokens of a hard deleted user went with the row, the account check rejects the rest
+	if hard {
+		return nil
+	}
+	return us.Tokens.LogoutAll(userId)
+}
+
+// checkAdminTarget refuses admin actions on the admin's own account, which has
+// self-service routes of its own, and on users whose role holds a permission the
+// admin lacks (adminHolds).
+func checkAdminTarget(db *sqlx.DB, userId, adminId string, adminHolds func(permission string) bool) error {
+	if userId == adminId {
+		return fmt.Errorf("admins can't do this to their own account")
+	}
+
+	var granted []string
+	query := `
+	SELECT rp.permission FROM users u
+	JOIN role_permissions rp ON rp.role = u.role
+	WHERE u.userid = $1
+	`
+	if err := db.Select(&granted, query, userId); err != nil {
+		return fmt.Errorf("error checking user's role: %w", err)
+	}
+
+	for _, permission := range granted {
+		if !adminHolds(permission) {
+			return fmt.Errorf("the user's role holds permission %s, which you don't hold", permission)
+		}
+	}
+
+	return nil
+}
+
+// releaseUserBookings cancels the user's upcoming reservations and releases
+// their active seat holds, returning all seats to the showtimes.
+func releaseUserBookings(tx *sqlx.Tx, userId string) error {
+	var reservations []models.Reservation
+	reservationQuery := `
+	SELECT * FROM reservations
+	WHERE userid = $1 AND status = 'confirmed' AND reservationdate > CURRENT_TIMESTAMP
+	FOR UPDATE
+	`
+	err := tx.Select(&reservations, reservationQuery, userId)
+	if err != nil {
+		return fmt.Errorf("error fetching reservations: %w", err)
+	}
+
+	for i := range reservations {
+		if err = helpers.ReleaseReservation(tx, &reservations[i]); err != nil {
+			return err
+		}
+	}
+
+	var holds []models.SeatHold
+	holdQuery := `SELECT * FROM seat_holds WHERE userid = $1 AND status = 'active' FOR UPDATE`
+	err = tx.Select(&holds, holdQuery, userId)
+	if err != nil {
+		return fmt.Errorf("error fetching seat holds: %w", err)
+	}
+
+	for i := range holds {
+		if err = finishHold(tx, &holds[i], models.HoldStatusReleased); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
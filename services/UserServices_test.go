@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"movie/internal/testutil"
+	"movie/models"
+	"movie/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAdminActionsRespectTheTargetsRole(t *testing.T) {
+	db := testutil.DB(t)
+	tokens := services.NewTokenService(db, services.NewMemoryRevocationStore())
+	us := services.NewuserService(db, tokens, nil, nil, nil)
+	ps := services.NewPrivacyService(db, tokens)
+
+	adminId := testutil.User(t, db).String()
+	superAdminId := testutil.User(t, db).String()
+	if _, err := db.Exec(`UPDATE users SET role = 'admin' WHERE userid = $1`, superAdminId); err != nil {
+		t.Fatalf("failed to promote user: %v", err)
+	}
+
+	// The acting admin only holds users:manage, the super-admin holds everything
+	adminHolds := func(permission string) bool { return permission == models.PermUsersManage }
+
+	actions := map[string]func(userId string) error{
+		"suspend": func(userId string) error { return us.Suspend(userId, "", adminId, adminHolds) },
+		"delete":  func(userId string) error { return us.DeleteUser(userId, false, adminId, adminHolds) },
+		"erase":   func(userId string) error { return ps.EraseUser(userId, adminId, adminHolds) },
+	}
+
+	for name, action := range actions {
+		t.Run(name, func(t *testing.T) {
+			if err := action(adminId); err == nil || !strings.Contains(err.Error(), "own account") {
+				t.Errorf("expected acting on the own account to fail, got %v", err)
+			}
+			if err := action(superAdminId); err == nil || !strings.Contains(err.Error(), "don't hold") {
+				t.Errorf("expected acting on a super-admin to fail, got %v", err)
+			}
+			if err := action(testutil.User(t, db).String()); err != nil {
+				t.Errorf("failed to act on a customer: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileIsAllOrNothing(t *testing.T) {
+	db := testutil.DB(t)
+	us := services.NewuserService(db, nil, nil, nil, nil)
+
+	userId := testutil.User(t, db)
+	testutil.DateOfBirth(t, db, userId, time.Date(1990, time.May, 1, 0, 0, 0, 0, time.UTC))
+
+	name := "New Name"
+	birthDate := time.Date(1980, time.May, 1, 0, 0, 0, 0, time.UTC)
+	_, err := us.UpdateProfile(userId.String(), &models.ProfileUpdate{Name: &name, DateOfBirth: &birthDate})
+	if err == nil || !strings.Contains(err.Error(), "already set") {
+		t.Fatalf("expected changing the date of birth to fail, got %v", err)
+	}
+
+	user, err := us.GetProfile(userId.String())
+	if err != nil {
+		t.Fatalf("failed to fetch profile: %v", err)
+	}
+	if user.Name == name {
+		t.Error("expected the name to stay when the update is refused")
+	}
+
+	if user, err = us.UpdateProfile(userId.String(), &models.ProfileUpdate{Name: &name}); err != nil {
+		t.Fatalf("failed to update name: %v", err)
+	}
+	if user.Name != name {
+		t.Errorf("expected name %q, got %q", name, user.Name)
+	}
+}
+
+func TestGetUsersSearchIsLiteral(t *testing.T) {
+	db := testutil.DB(t)
+	us := services.NewuserService(db, nil, nil, nil, nil)
+
+	marker := uuid.New().String()[:8]
+	for _, name := range []string{marker + " 100% Real", marker + " 100 Real", marker + " A_B"} {
+		if _, err := db.Exec(`UPDATE users SET name = $2 WHERE userid = $1`, testutil.User(t, db).String(), name); err != nil {
+			t.Fatalf("failed to name user: %v", err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   int
+	}{
+		{marker, 3},
+		{marker + " 100%", 1},
+		{marker + " 100", 2},
+		{marker + " A_", 1},
+		{marker + " _", 0},
+	}
+
+	for _, tt := range tests {
+		page, err := us.GetUsers(tt.search, 1, 10, false)
+		if err != nil {
+			t.Fatalf("failed to search users: %v", err)
+		}
+		if page.Total != tt.want {
+			t.Errorf("search %q: expected %d users, got %d", tt.search, tt.want, page.Total)
+		}
+	}
+}